@@ -0,0 +1,214 @@
+package lampofs
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/vanvanni/lampofs/errors"
+	"sync"
+)
+
+// AuditRecord is one line of an audit log. Hash covers every other field,
+// PrevHash included, so each record vouches for the one before it.
+type AuditRecord struct {
+	Seq       int64           `json:"seq"`
+	Type      string          `json:"type"`
+	Path      string          `json:"path"`
+	Timestamp int64           `json:"timestamp"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash,omitempty"`
+}
+
+// AuditLog appends LampEvents as hash-chained JSON lines to a file on any
+// driver. Use VerifyAuditLog to check that no record was altered, removed
+// or reordered.
+type AuditLog struct {
+	driver Driver
+	path   string
+	seq    int64
+	head   string
+	err    error
+	mutex  sync.Mutex
+}
+
+// NewAuditLog continues the chain of the log at path, or starts a new one
+// when the file does not exist yet. An existing log must verify.
+func NewAuditLog(driver Driver, path string) (*AuditLog, error) {
+	records, err := readAuditLog(driver, path)
+	if err != nil && err != errors.ErrFileNotFound {
+		return nil, err
+	}
+
+	log := &AuditLog{
+		driver: driver,
+		path:   path,
+	}
+
+	if len(records) > 0 {
+		last := records[len(records)-1]
+		log.seq = last.Seq
+		log.head = last.Hash
+	}
+
+	return log, nil
+}
+
+// Attach records every event of lampo. Failures to write the log are kept
+// and reported by Err, since event handlers cannot return errors.
+func (a *AuditLog) Attach(lampo *Lampo) {
+	lampo.On(func(event LampEvent) {
+		if err := a.Append(event); err != nil {
+			a.mutex.Lock()
+			if a.err == nil {
+				a.err = err
+			}
+			a.mutex.Unlock()
+		}
+	})
+}
+
+// Err returns the first error an attached log ran into.
+func (a *AuditLog) Err() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.err
+}
+
+// Head returns the hash of the last record. Keeping a copy elsewhere lets
+// VerifyAuditLog notice records cut off the end of the log.
+func (a *AuditLog) Head() string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.head
+}
+
+func (a *AuditLog) Append(event LampEvent) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	record := AuditRecord{
+		Seq:       a.seq + 1,
+		Type:      event.Type,
+		Path:      event.Path,
+		Timestamp: event.Timestamp,
+		PrevHash:  a.head,
+	}
+
+	if event.Data != nil {
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		record.Data = data
+	}
+
+	hash, err := auditHash(record)
+	if err != nil {
+		return err
+	}
+	record.Hash = hash
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := a.driver.Update(a.path, append(line, '\n'), false); err != nil {
+		return err
+	}
+
+	a.seq = record.Seq
+	a.head = record.Hash
+	return nil
+}
+
+// VerifyAuditLog checks every record of the log at path against its hash
+// and its predecessor and returns the hash of the last record. A broken
+// chain fails with an *errors.AuditError. Pass the head kept from
+// AuditLog.Head to also detect records removed from the end, or "" to skip
+// that check.
+func VerifyAuditLog(driver Driver, path string, head string) (string, error) {
+	records, err := readAuditLog(driver, path)
+	if err != nil {
+		return "", err
+	}
+
+	last := ""
+	if len(records) > 0 {
+		last = records[len(records)-1].Hash
+	}
+
+	if head != "" && last != head {
+		return last, &errors.AuditError{
+			Line:   len(records),
+			Reason: "log does not end at the expected head",
+		}
+	}
+
+	return last, nil
+}
+
+// readAuditLog parses and verifies the whole log.
+func readAuditLog(driver Driver, path string) ([]AuditRecord, error) {
+	reader, err := driver.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	records := make([]AuditRecord, 0)
+	previous := ""
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, &errors.AuditError{Line: line, Reason: "malformed record"}
+		}
+
+		if record.Seq != int64(line) {
+			return nil, &errors.AuditError{Line: line, Reason: fmt.Sprintf("expected seq %d, found %d", line, record.Seq)}
+		}
+
+		if record.PrevHash != previous {
+			return nil, &errors.AuditError{Line: line, Reason: "previous hash does not match"}
+		}
+
+		hash, err := auditHash(record)
+		if err != nil {
+			return nil, err
+		}
+
+		if hash != record.Hash {
+			return nil, &errors.AuditError{Line: line, Reason: "record hash does not match"}
+		}
+
+		records = append(records, record)
+		previous = record.Hash
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+func auditHash(record AuditRecord) (string, error) {
+	record.Hash = ""
+
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
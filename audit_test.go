@@ -0,0 +1,101 @@
+package lampofs
+
+import (
+	goerrors "errors"
+	"github.com/vanvanni/lampofs/drivers"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readAuditLines(t *testing.T, driver Driver, path string) []string {
+	t.Helper()
+
+	reader, err := driver.Read(path)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer reader.Close()
+
+	data, _ := io.ReadAll(reader)
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+func newTestAuditLog(t *testing.T) (*drivers.MemoryDriver, *AuditLog) {
+	t.Helper()
+
+	memory := drivers.NewMemoryDriver()
+	audit, err := NewAuditLog(memory, "audit.jsonl")
+	assert.NoError(t, err)
+
+	lampo := NewLampo(drivers.NewMemoryDriver())
+	audit.Attach(lampo)
+
+	lampo.Write("a.txt", []byte("hello"))
+	lampo.Update("a.txt", []byte("!"), false)
+	lampo.Delete("a.txt")
+	assert.NoError(t, audit.Err())
+
+	return memory, audit
+}
+
+func TestAuditLog(t *testing.T) {
+	memory, audit := newTestAuditLog(t)
+
+	lines := readAuditLines(t, memory, "audit.jsonl")
+	assert.Len(t, lines, 3)
+	assert.Contains(t, lines[0], `"type":"WRITE","path":"a.txt"`)
+	assert.Contains(t, lines[0], `"data":5`)
+
+	head, err := VerifyAuditLog(memory, "audit.jsonl", audit.Head())
+	assert.NoError(t, err)
+	assert.Equal(t, audit.Head(), head)
+
+	// A reopened log continues the chain
+	reopened, err := NewAuditLog(memory, "audit.jsonl")
+	assert.NoError(t, err)
+	assert.NoError(t, reopened.Append(LampEvent{Type: "READ", Path: "b.txt"}))
+
+	_, err = VerifyAuditLog(memory, "audit.jsonl", reopened.Head())
+	assert.NoError(t, err)
+}
+
+func TestAuditLogAlteredRecord(t *testing.T) {
+	memory, _ := newTestAuditLog(t)
+
+	lines := readAuditLines(t, memory, "audit.jsonl")
+	lines[1] = strings.Replace(lines[1], `"path":"a.txt"`, `"path":"b.txt"`, 1)
+	memory.Put("audit.jsonl", []byte(strings.Join(lines, "\n")+"\n"))
+
+	_, err := VerifyAuditLog(memory, "audit.jsonl", "")
+	assert.True(t, goerrors.Is(err, errors.ErrAuditTampered))
+
+	var auditErr *errors.AuditError
+	if assert.True(t, goerrors.As(err, &auditErr)) {
+		assert.Equal(t, 2, auditErr.Line)
+	}
+
+	_, err = NewAuditLog(memory, "audit.jsonl")
+	assert.True(t, goerrors.Is(err, errors.ErrAuditTampered))
+}
+
+func TestAuditLogMissingRecord(t *testing.T) {
+	memory, audit := newTestAuditLog(t)
+	lines := readAuditLines(t, memory, "audit.jsonl")
+
+	// Removed from the middle
+	memory.Put("audit.jsonl", []byte(lines[0]+"\n"+lines[2]+"\n"))
+	_, err := VerifyAuditLog(memory, "audit.jsonl", "")
+	assert.True(t, goerrors.Is(err, errors.ErrAuditTampered))
+
+	// Cut off the end, only the saved head notices
+	memory.Put("audit.jsonl", []byte(lines[0]+"\n"+lines[1]+"\n"))
+	_, err = VerifyAuditLog(memory, "audit.jsonl", "")
+	assert.NoError(t, err)
+
+	_, err = VerifyAuditLog(memory, "audit.jsonl", audit.Head())
+	assert.True(t, goerrors.Is(err, errors.ErrAuditTampered))
+}
@@ -0,0 +1,286 @@
+package drivers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type ACLEffect string
+
+const (
+	ACLAllow ACLEffect = "allow"
+	ACLDeny  ACLEffect = "deny"
+)
+
+// ACLRule applies to calls by Principal ("*" for anyone) doing one of
+// Operations (READ, WRITE, PUT, DELETE, UPDATE or LIST, empty for all) on
+// a path matching Path. Path is a path.Match pattern on the full path, and
+// a trailing "/**" matches everything below a directory.
+type ACLRule struct {
+	Principal  string    `json:"principal" yaml:"principal"`
+	Operations []string  `json:"operations" yaml:"operations"`
+	Path       string    `json:"path" yaml:"path"`
+	Effect     ACLEffect `json:"effect" yaml:"effect"`
+}
+
+// ACLPolicy allows a call when an allow rule matches and no deny rule
+// does. Calls no rule matches are allowed unless DefaultDeny is set.
+type ACLPolicy struct {
+	DefaultDeny bool      `json:"default_deny" yaml:"default_deny"`
+	Rules       []ACLRule `json:"rules" yaml:"rules"`
+}
+
+// ACLDenial describes a call the policy refused.
+type ACLDenial struct {
+	Principal string
+	Operation string
+	Path      string
+	Rule      *ACLRule // the deny rule, nil when denied by default
+	Timestamp int64
+}
+
+type ACLOptions struct {
+	Policy ACLPolicy
+	// OnDenied is called for every refused call, for audit logs.
+	OnDenied func(denial ACLDenial)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the principal ACLDriver.For
+// checks calls against.
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+func PrincipalFrom(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(principalKey{}).(string)
+	return principal, ok
+}
+
+// ACLDriver checks every call against a policy and fails refused calls
+// with ErrPermissionDenied. Operations do not take a context yet, so use
+// For to get a view bound to the principal of a request. Calls made on
+// the driver itself run as the anonymous principal "".
+type ACLDriver struct {
+	driver    Driver
+	opts      ACLOptions
+	principal string
+}
+
+// NewACLDriver matches effects without regard to case. Rules with an
+// effect other than allow are treated as deny.
+func NewACLDriver(driver Driver, opts ACLOptions) *ACLDriver {
+	rules := make([]ACLRule, len(opts.Policy.Rules))
+	for i, rule := range opts.Policy.Rules {
+		operations := make([]string, len(rule.Operations))
+		for j, operation := range rule.Operations {
+			operations[j] = strings.ToUpper(operation)
+		}
+
+		rule.Operations = operations
+
+		// A misspelt effect must not open anything up
+		effect, ok := parseACLEffect(rule.Effect)
+		if !ok {
+			effect = ACLDeny
+		}
+		rule.Effect = effect
+
+		rules[i] = rule
+	}
+	opts.Policy.Rules = rules
+
+	return &ACLDriver{
+		driver: driver,
+		opts:   opts,
+	}
+}
+
+// LoadACLPolicy reads a JSON or YAML policy file, picking the format from
+// the file extension. Effects are matched without regard to case, unknown
+// ones are an error.
+func LoadACLPolicy(path string) (ACLPolicy, error) {
+	var policy ACLPolicy
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return policy, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &policy)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &policy)
+	default:
+		err = fmt.Errorf("unsupported policy format %q", filepath.Ext(path))
+	}
+
+	if err != nil {
+		return policy, err
+	}
+
+	for i, rule := range policy.Rules {
+		effect, ok := parseACLEffect(rule.Effect)
+		if !ok {
+			return policy, fmt.Errorf("rule %d: unknown effect %q", i, rule.Effect)
+		}
+		policy.Rules[i].Effect = effect
+	}
+
+	return policy, nil
+}
+
+func parseACLEffect(effect ACLEffect) (ACLEffect, bool) {
+	effect = ACLEffect(strings.ToLower(string(effect)))
+	return effect, effect == ACLAllow || effect == ACLDeny
+}
+
+// For returns a view of the driver that runs calls as the principal in
+// ctx, or as the anonymous principal when ctx has none.
+func (d *ACLDriver) For(ctx context.Context) *ACLDriver {
+	principal, _ := PrincipalFrom(ctx)
+
+	return &ACLDriver{
+		driver:    d.driver,
+		opts:      d.opts,
+		principal: principal,
+	}
+}
+
+func (d *ACLDriver) Read(path string) (io.ReadCloser, error) {
+	if err := d.check("READ", path); err != nil {
+		return nil, err
+	}
+
+	return d.driver.Read(path)
+}
+
+func (d *ACLDriver) Write(path string, data []byte) error {
+	if err := d.check("WRITE", path); err != nil {
+		return err
+	}
+
+	return d.driver.Write(path, data)
+}
+
+func (d *ACLDriver) Put(path string, data []byte) error {
+	if err := d.check("PUT", path); err != nil {
+		return err
+	}
+
+	return d.driver.Put(path, data)
+}
+
+func (d *ACLDriver) Delete(path string) error {
+	if err := d.check("DELETE", path); err != nil {
+		return err
+	}
+
+	return d.driver.Delete(path)
+}
+
+func (d *ACLDriver) Update(path string, data []byte, prepend bool) error {
+	if err := d.check("UPDATE", path); err != nil {
+		return err
+	}
+
+	return d.driver.Update(path, data, prepend)
+}
+
+// List checks the prefix itself, then drops results the principal may not
+// read.
+func (d *ACLDriver) List(prefix string) ([]string, error) {
+	if err := d.check("LIST", prefix); err != nil {
+		return nil, err
+	}
+
+	paths, err := listFiles(d.driver, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if allowed, _ := d.evaluate("READ", path); allowed {
+			visible = append(visible, path)
+		}
+	}
+
+	return visible, nil
+}
+
+func (d *ACLDriver) check(operation, path string) error {
+	allowed, rule := d.evaluate(operation, path)
+	if allowed {
+		return nil
+	}
+
+	if d.opts.OnDenied != nil {
+		d.opts.OnDenied(ACLDenial{
+			Principal: d.principal,
+			Operation: operation,
+			Path:      path,
+			Rule:      rule,
+			Timestamp: time.Now().Unix(),
+		})
+	}
+
+	return errors.ErrPermissionDenied
+}
+
+// evaluate returns whether the call is allowed and the deny rule that
+// refused it, if any. Rules match the cleaned path, and paths climbing
+// above the root with ".." are always refused.
+func (d *ACLDriver) evaluate(operation, path string) (bool, *ACLRule) {
+	path, err := cleanPath(path)
+	if err != nil {
+		return false, nil
+	}
+
+	allowed := !d.opts.Policy.DefaultDeny
+
+	for i := range d.opts.Policy.Rules {
+		rule := &d.opts.Policy.Rules[i]
+		if !rule.matches(d.principal, operation, path) {
+			continue
+		}
+
+		if rule.Effect == ACLDeny {
+			return false, rule
+		}
+		allowed = true
+	}
+
+	return allowed, nil
+}
+
+func (r *ACLRule) matches(principal, operation, path string) bool {
+	if r.Principal != "*" && r.Principal != principal {
+		return false
+	}
+
+	if len(r.Operations) > 0 && !slices.Contains(r.Operations, operation) {
+		return false
+	}
+
+	pattern := strings.TrimPrefix(r.Path, "/")
+	if dir, found := strings.CutSuffix(pattern, "**"); found && (dir == "" || strings.HasSuffix(dir, "/")) {
+		return strings.HasPrefix(path, dir)
+	}
+
+	matched, _ := pathpkg.Match(pattern, path)
+	return matched
+}
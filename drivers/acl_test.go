@@ -0,0 +1,166 @@
+package drivers
+
+import (
+	"context"
+	"github.com/vanvanni/lampofs/errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACLDriver(t *testing.T) {
+	memory := NewMemoryDriver()
+	memory.Put("reports/q1.pdf", []byte("q1"))
+	memory.Put("reports/secret/plan.pdf", []byte("plan"))
+
+	acl := NewACLDriver(memory, ACLOptions{Policy: ACLPolicy{
+		DefaultDeny: true,
+		Rules: []ACLRule{
+			{Principal: "*", Operations: []string{"read", "list"}, Path: "reports/**", Effect: ACLAllow},
+			{Principal: "alice", Path: "reports/**", Effect: ACLAllow},
+			{Principal: "*", Path: "reports/secret/**", Effect: ACLDeny},
+		},
+	}})
+
+	alice := acl.For(WithPrincipal(context.Background(), "alice"))
+	bob := acl.For(WithPrincipal(context.Background(), "bob"))
+
+	assert.NoError(t, alice.Put("reports/q2.pdf", []byte("q2")))
+	assert.Equal(t, errors.ErrPermissionDenied, bob.Put("reports/q3.pdf", []byte("q3")))
+	assert.Equal(t, "q2", readString(t, bob, "reports/q2.pdf"))
+
+	// Deny rules win over allow rules
+	_, err := alice.Read("reports/secret/plan.pdf")
+	assert.Equal(t, errors.ErrPermissionDenied, err)
+
+	// Nothing allows anything outside reports/
+	assert.Equal(t, errors.ErrPermissionDenied, alice.Put("other.txt", []byte("x")))
+
+	paths, err := bob.List("reports/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"reports/q1.pdf", "reports/q2.pdf"}, paths)
+
+	// Without a principal in the context calls are anonymous
+	assert.Equal(t, errors.ErrPermissionDenied, acl.For(context.Background()).Delete("reports/q1.pdf"))
+}
+
+func TestACLDriverAllowByDefault(t *testing.T) {
+	acl := NewACLDriver(NewMemoryDriver(), ACLOptions{Policy: ACLPolicy{
+		Rules: []ACLRule{{Principal: "*", Operations: []string{"DELETE"}, Path: "*.lock", Effect: ACLDeny}},
+	}})
+
+	assert.NoError(t, acl.Put("app.lock", []byte("1")))
+	assert.Equal(t, errors.ErrPermissionDenied, acl.Delete("app.lock"))
+
+	assert.NoError(t, acl.Put("app.txt", []byte("1")))
+	assert.NoError(t, acl.Delete("app.txt"))
+}
+
+func TestACLDriverDenials(t *testing.T) {
+	denials := make([]ACLDenial, 0)
+	acl := NewACLDriver(NewMemoryDriver(), ACLOptions{
+		Policy: ACLPolicy{
+			DefaultDeny: true,
+			Rules:       []ACLRule{{Principal: "*", Path: "tmp/*", Effect: ACLDeny}},
+		},
+		OnDenied: func(denial ACLDenial) {
+			denials = append(denials, denial)
+		},
+	})
+
+	carol := acl.For(WithPrincipal(context.Background(), "carol"))
+	carol.Put("tmp/a.txt", []byte("a"))
+	carol.Read("b.txt")
+
+	if !assert.Len(t, denials, 2) {
+		return
+	}
+
+	assert.Equal(t, "carol", denials[0].Principal)
+	assert.Equal(t, "PUT", denials[0].Operation)
+	assert.Equal(t, "tmp/a.txt", denials[0].Path)
+	assert.Equal(t, ACLDeny, denials[0].Rule.Effect)
+
+	assert.Equal(t, "READ", denials[1].Operation)
+	assert.Nil(t, denials[1].Rule)
+}
+
+func TestLoadACLPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "policy.yaml")
+	os.WriteFile(yamlPath, []byte(`
+default_deny: true
+rules:
+  - principal: backup
+    operations: [read, list]
+    path: "**"
+    effect: Allow
+`), 0644)
+
+	policy, err := LoadACLPolicy(yamlPath)
+	assert.NoError(t, err)
+	assert.True(t, policy.DefaultDeny)
+	assert.Equal(t, []ACLRule{{Principal: "backup", Operations: []string{"read", "list"}, Path: "**", Effect: ACLAllow}}, policy.Rules)
+
+	jsonPath := filepath.Join(dir, "policy.json")
+	os.WriteFile(jsonPath, []byte(`{"rules": [{"principal": "*", "path": "*", "effect": "maybe"}]}`), 0644)
+
+	_, err = LoadACLPolicy(jsonPath)
+	assert.Error(t, err)
+}
+
+func TestACLDriverListHidesUnreadable(t *testing.T) {
+	memory := NewMemoryDriver()
+	memory.Put("public/a.txt", []byte("a"))
+	memory.Put("secret/key", []byte("key"))
+
+	acl := NewACLDriver(memory, ACLOptions{Policy: ACLPolicy{
+		Rules: []ACLRule{{Principal: "*", Operations: []string{"READ"}, Path: "secret/**", Effect: ACLDeny}},
+	}})
+
+	paths, err := acl.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"public/a.txt"}, paths)
+}
+
+func TestACLDriverCleansPaths(t *testing.T) {
+	local, err := NewLocalDriver(t.TempDir())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	local.Put("secrets/key", []byte("key"))
+	local.Put("public/index.html", []byte("index"))
+
+	acl := NewACLDriver(local, ACLOptions{Policy: ACLPolicy{
+		Rules: []ACLRule{{Principal: "*", Path: "secrets/**", Effect: ACLDeny}},
+	}})
+
+	for _, path := range []string{"secrets/key", "public/../secrets/key", "./secrets/key", "/secrets//key"} {
+		_, err := acl.Read(path)
+		assert.Equal(t, errors.ErrPermissionDenied, err, path)
+	}
+
+	_, err = acl.Read("../outside")
+	assert.Equal(t, errors.ErrPermissionDenied, err)
+
+	assert.Equal(t, "index", readString(t, acl, "public/./index.html"))
+}
+
+func TestACLDriverEffectCase(t *testing.T) {
+	acl := NewACLDriver(NewMemoryDriver(), ACLOptions{Policy: ACLPolicy{
+		DefaultDeny: true,
+		Rules: []ACLRule{
+			{Principal: "*", Path: "**", Effect: "Allow"},
+			{Principal: "*", Path: "private/**", Effect: "Deny"},
+			{Principal: "*", Path: "typo/**", Effect: "alow"},
+		},
+	}})
+
+	assert.NoError(t, acl.Put("public/a.txt", []byte("a")))
+	assert.Equal(t, errors.ErrPermissionDenied, acl.Put("private/a.txt", []byte("a")))
+	assert.Equal(t, errors.ErrPermissionDenied, acl.Put("typo/a.txt", []byte("a")))
+}
@@ -0,0 +1,459 @@
+package drivers
+
+import (
+	goerrors "errors"
+	"fmt"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"sync"
+	"time"
+)
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+
+	return "closed"
+}
+
+type BreakerOptions struct {
+	WindowSize    int           // recent calls considered for the failure rate, default 20
+	MinRequests   int           // calls needed in the window before tripping, default 10
+	FailureRate   float64       // share of failed calls that opens the circuit, default 0.5
+	SlowCall      time.Duration // calls slower than this count as failures, 0 disables
+	OpenTimeout   time.Duration // time spent open before a trial call, default 30s
+	TrialRequests int           // calls let through while half-open, default 1
+	// Classifier reports whether an error counts as a failure. Nil uses
+	// IsRetryable, so missing files and other permanent errors do not trip
+	// the circuit.
+	Classifier func(err error) bool
+	// Fallback accepts writes while the circuit is open and serves reads
+	// of what it holds. Spooled changes are replayed to the primary once
+	// it recovers.
+	Fallback Driver
+}
+
+// BreakerDriver stops calling a failing driver for a while. Calls made
+// while the circuit is open fail with ErrCircuitOpen, or go to the
+// fallback driver when there is one.
+type BreakerDriver struct {
+	driver Driver
+	opts   BreakerOptions
+	now    func() time.Time
+
+	state     BreakerState
+	window    []bool
+	openedAt  time.Time
+	trials    int
+	spool     []spooledChange
+	partial   map[string]bool
+	conflicts []error
+	mutex     sync.Mutex // circuit state and spool bookkeeping, never held for I/O
+	spooling  sync.Mutex // fallback I/O for the spool
+	replay    sync.Mutex
+}
+
+type spooledChange struct {
+	operation string
+	path      string
+	data      []byte
+	prepend   bool
+}
+
+func NewBreakerDriver(driver Driver, opts BreakerOptions) *BreakerDriver {
+	if opts.WindowSize <= 0 {
+		opts.WindowSize = 20
+	}
+
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = 10
+	}
+
+	if opts.FailureRate <= 0 {
+		opts.FailureRate = 0.5
+	}
+
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = 30 * time.Second
+	}
+
+	if opts.TrialRequests <= 0 {
+		opts.TrialRequests = 1
+	}
+
+	if opts.Classifier == nil {
+		opts.Classifier = IsRetryable
+	}
+
+	return &BreakerDriver{
+		driver:  driver,
+		opts:    opts,
+		now:     time.Now,
+		partial: make(map[string]bool),
+	}
+}
+
+func (d *BreakerDriver) Read(path string) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+
+	err := d.call(func() error {
+		var err error
+		reader, err = d.driver.Read(path)
+		return err
+	}, func() error {
+		if d.opts.Fallback == nil {
+			return errors.ErrCircuitOpen
+		}
+
+		d.mutex.Lock()
+		partial := d.partial[path]
+		d.mutex.Unlock()
+
+		// The fallback only holds what was appended during the outage
+		if partial {
+			return errors.ErrCircuitOpen
+		}
+
+		var err error
+		reader, err = d.opts.Fallback.Read(path)
+		if err == errors.ErrFileNotFound {
+			// The primary may well have it, we just cannot ask
+			return errors.ErrCircuitOpen
+		}
+		return err
+	})
+
+	return reader, err
+}
+
+func (d *BreakerDriver) Write(path string, data []byte) error {
+	return d.call(func() error {
+		return d.driver.Write(path, data)
+	}, func() error {
+		return d.spoolChange(spooledChange{operation: "WRITE", path: path, data: data}, func(fallback Driver) error {
+			return fallback.Write(path, data)
+		})
+	})
+}
+
+func (d *BreakerDriver) Put(path string, data []byte) error {
+	return d.call(func() error {
+		return d.driver.Put(path, data)
+	}, func() error {
+		return d.spoolChange(spooledChange{operation: "PUT", path: path, data: data}, func(fallback Driver) error {
+			return fallback.Put(path, data)
+		})
+	})
+}
+
+func (d *BreakerDriver) Delete(path string) error {
+	return d.call(func() error {
+		return d.driver.Delete(path)
+	}, func() error {
+		return d.spoolChange(spooledChange{operation: "DELETE", path: path}, func(fallback Driver) error {
+			err := fallback.Delete(path)
+			if err == errors.ErrFileNotFound {
+				return nil
+			}
+			return err
+		})
+	})
+}
+
+func (d *BreakerDriver) Update(path string, data []byte, prepend bool) error {
+	return d.call(func() error {
+		return d.driver.Update(path, data, prepend)
+	}, func() error {
+		return d.spoolChange(spooledChange{operation: "UPDATE", path: path, data: data, prepend: prepend}, func(fallback Driver) error {
+			return fallback.Update(path, data, prepend)
+		})
+	})
+}
+
+func (d *BreakerDriver) List(prefix string) ([]string, error) {
+	var paths []string
+
+	err := d.call(func() error {
+		var err error
+		paths, err = listFiles(d.driver, prefix)
+		return err
+	}, func() error {
+		return errors.ErrCircuitOpen
+	})
+
+	return paths, err
+}
+
+func (d *BreakerDriver) State() BreakerState {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.advance()
+	return d.state
+}
+
+// Pending returns the number of spooled changes waiting for replay.
+func (d *BreakerDriver) Pending() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return len(d.spool)
+}
+
+// Conflicts returns the spooled changes the primary refused during
+// replay, like a WRITE to a path that already existed there.
+func (d *BreakerDriver) Conflicts() []error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return append([]error{}, d.conflicts...)
+}
+
+// Replay sends spooled changes to the primary in order and removes the
+// spooled copies from the fallback. A transient failure stops it and keeps
+// the remaining changes queued. Changes the primary refuses for good are
+// dropped and reported, both in the returned error and by Conflicts.
+// Every call that gets through to the primary runs Replay first, so the
+// spool empties on its own once the primary is back.
+func (d *BreakerDriver) Replay() error {
+	d.replay.Lock()
+	defer d.replay.Unlock()
+
+	var conflicts []error
+	for {
+		d.mutex.Lock()
+		if len(d.spool) == 0 {
+			d.mutex.Unlock()
+			return goerrors.Join(conflicts...)
+		}
+		change := d.spool[0]
+		d.mutex.Unlock()
+
+		err := d.apply(change)
+		if err != nil && d.opts.Classifier(err) {
+			return goerrors.Join(append(conflicts, err)...)
+		}
+
+		d.mutex.Lock()
+		if err != nil {
+			err = fmt.Errorf("replay %s %s: %w", change.operation, change.path, err)
+			conflicts = append(conflicts, err)
+			d.conflicts = append(d.conflicts, err)
+		}
+
+		d.spool = d.spool[1:]
+		d.mutex.Unlock()
+
+		if err := d.dropSpooled(change.path); err != nil {
+			return goerrors.Join(append(conflicts, err)...)
+		}
+	}
+}
+
+// dropSpooled deletes the fallback copy of path once no spooled change
+// needs it anymore.
+func (d *BreakerDriver) dropSpooled(path string) error {
+	d.spooling.Lock()
+	defer d.spooling.Unlock()
+
+	d.mutex.Lock()
+	last := !d.spooled(path)
+	if last {
+		delete(d.partial, path)
+	}
+	d.mutex.Unlock()
+
+	if !last {
+		return nil
+	}
+
+	err := d.opts.Fallback.Delete(path)
+	if err == errors.ErrFileNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func (d *BreakerDriver) apply(change spooledChange) error {
+	var err error
+
+	switch change.operation {
+	case "WRITE":
+		err = d.driver.Write(change.path, change.data)
+	case "PUT":
+		err = d.driver.Put(change.path, change.data)
+	case "DELETE":
+		err = d.driver.Delete(change.path)
+		if err == errors.ErrFileNotFound {
+			err = nil
+		}
+	case "UPDATE":
+		err = d.driver.Update(change.path, change.data, change.prepend)
+	}
+
+	return err
+}
+
+// call runs primary when the circuit lets it through and open otherwise.
+// While spooled changes are left, it replays them first and keeps using
+// open until they are through, so nothing overtakes them.
+func (d *BreakerDriver) call(primary func() error, open func() error) error {
+	if !d.allow() {
+		return open()
+	}
+
+	if d.opts.Fallback != nil && d.Pending() > 0 {
+		// Refused changes are kept for Conflicts, only a stuck spool
+		// counts against the primary
+		d.Replay()
+		if d.Pending() > 0 {
+			d.record(true)
+			return open()
+		}
+	}
+
+	start := d.now()
+	err := primary()
+	failed := (err != nil && d.opts.Classifier(err)) ||
+		(d.opts.SlowCall > 0 && d.now().Sub(start) > d.opts.SlowCall)
+
+	d.record(failed)
+	return err
+}
+
+func (d *BreakerDriver) spoolChange(change spooledChange, apply func(fallback Driver) error) error {
+	if d.opts.Fallback == nil {
+		return errors.ErrCircuitOpen
+	}
+
+	d.spooling.Lock()
+	defer d.spooling.Unlock()
+
+	d.mutex.Lock()
+	partial := d.partial[change.path]
+	spooled := d.spooled(change.path)
+	d.mutex.Unlock()
+
+	// Updates are replayed on top of what the primary holds. Without a
+	// full copy in the fallback, reads cannot be served until then.
+	switch change.operation {
+	case "UPDATE":
+		if !partial {
+			_, err := readSize(d.opts.Fallback, change.path)
+			if err != nil && err != errors.ErrFileNotFound {
+				return err
+			}
+			partial = err == errors.ErrFileNotFound && !spooled
+		}
+	default:
+		partial = false
+	}
+
+	if err := apply(d.opts.Fallback); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if partial {
+		d.partial[change.path] = true
+	} else {
+		delete(d.partial, change.path)
+	}
+
+	d.spool = append(d.spool, change)
+	return nil
+}
+
+func (d *BreakerDriver) allow() bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.advance()
+
+	switch d.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if d.trials >= d.opts.TrialRequests {
+			return false
+		}
+		d.trials++
+	}
+
+	return true
+}
+
+// record adds an outcome and moves the state machine.
+func (d *BreakerDriver) record(failed bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.state == BreakerHalfOpen {
+		if failed {
+			d.trip()
+			return
+		}
+
+		d.state = BreakerClosed
+		d.window = d.window[:0]
+		return
+	}
+
+	d.window = append(d.window, failed)
+	if len(d.window) > d.opts.WindowSize {
+		d.window = d.window[1:]
+	}
+
+	if len(d.window) < d.opts.MinRequests {
+		return
+	}
+
+	failures := 0
+	for _, outcome := range d.window {
+		if outcome {
+			failures++
+		}
+	}
+
+	if float64(failures)/float64(len(d.window)) >= d.opts.FailureRate {
+		d.trip()
+	}
+}
+
+func (d *BreakerDriver) trip() {
+	d.state = BreakerOpen
+	d.openedAt = d.now()
+	d.trials = 0
+}
+
+func (d *BreakerDriver) advance() {
+	if d.state == BreakerOpen && d.now().Sub(d.openedAt) >= d.opts.OpenTimeout {
+		d.state = BreakerHalfOpen
+		d.trials = 0
+	}
+}
+
+func (d *BreakerDriver) spooled(path string) bool {
+	for _, change := range d.spool {
+		if change.path == path {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,233 @@
+package drivers
+
+import (
+	goerrors "errors"
+	"github.com/vanvanni/lampofs/errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBreakerDriver(driver Driver, opts BreakerOptions) (*BreakerDriver, *time.Time) {
+	clock := time.Unix(0, 0)
+	breaker := NewBreakerDriver(driver, opts)
+	breaker.now = func() time.Time { return clock }
+
+	return breaker, &clock
+}
+
+func TestBreakerDriverOpensOnFailureRate(t *testing.T) {
+	primary := &failingDriver{Driver: NewMemoryDriver(), fail: true}
+	breaker, _ := newTestBreakerDriver(primary, BreakerOptions{MinRequests: 3})
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, errUnavailable, breaker.Put("a.txt", []byte("a")))
+	}
+
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.Equal(t, errors.ErrCircuitOpen, breaker.Put("a.txt", []byte("a")))
+
+	_, err := breaker.Read("a.txt")
+	assert.Equal(t, errors.ErrCircuitOpen, err)
+}
+
+func TestBreakerDriverIgnoresPermanentErrors(t *testing.T) {
+	breaker, _ := newTestBreakerDriver(NewMemoryDriver(), BreakerOptions{MinRequests: 3})
+
+	for i := 0; i < 5; i++ {
+		_, err := breaker.Read("missing.txt")
+		assert.Equal(t, errors.ErrFileNotFound, err)
+	}
+
+	assert.Equal(t, BreakerClosed, breaker.State())
+}
+
+func TestBreakerDriverSlowCalls(t *testing.T) {
+	breaker, clock := newTestBreakerDriver(NewMemoryDriver(), BreakerOptions{MinRequests: 2, SlowCall: time.Second})
+
+	// Each call moves the clock past the slow call threshold
+	now := breaker.now
+	breaker.now = func() time.Time {
+		*clock = clock.Add(2 * time.Second)
+		return now()
+	}
+
+	assert.NoError(t, breaker.Put("a.txt", []byte("a")))
+	assert.NoError(t, breaker.Put("b.txt", []byte("b")))
+	assert.Equal(t, BreakerOpen, breaker.State())
+}
+
+func TestBreakerDriverHalfOpen(t *testing.T) {
+	primary := &failingDriver{Driver: NewMemoryDriver(), fail: true}
+	breaker, clock := newTestBreakerDriver(primary, BreakerOptions{MinRequests: 1, OpenTimeout: time.Minute})
+
+	breaker.Put("a.txt", []byte("a"))
+	assert.Equal(t, BreakerOpen, breaker.State())
+
+	*clock = clock.Add(time.Minute)
+	assert.Equal(t, BreakerHalfOpen, breaker.State())
+
+	// A failed trial opens the circuit again
+	assert.Equal(t, errUnavailable, breaker.Put("a.txt", []byte("a")))
+	assert.Equal(t, BreakerOpen, breaker.State())
+
+	*clock = clock.Add(time.Minute)
+	primary.fail = false
+
+	assert.NoError(t, breaker.Put("a.txt", []byte("a")))
+	assert.Equal(t, BreakerClosed, breaker.State())
+}
+
+func TestBreakerDriverFallbackReplay(t *testing.T) {
+	memory := NewMemoryDriver()
+	memory.Write("log.txt", []byte("one\n"))
+	memory.Write("old.txt", []byte("old"))
+
+	primary := &failingDriver{Driver: memory, fail: true}
+	fallback := NewMemoryDriver()
+	breaker, clock := newTestBreakerDriver(primary, BreakerOptions{
+		MinRequests: 1,
+		OpenTimeout: time.Minute,
+		Fallback:    fallback,
+	})
+
+	breaker.Read("log.txt")
+	assert.Equal(t, BreakerOpen, breaker.State())
+
+	assert.NoError(t, breaker.Write("new.txt", []byte("new")))
+	assert.NoError(t, breaker.Update("log.txt", []byte("two\n"), false))
+	assert.NoError(t, breaker.Delete("old.txt"))
+	assert.Equal(t, 3, breaker.Pending())
+
+	// Spooled files are served from the fallback
+	assert.Equal(t, "new", readString(t, breaker, "new.txt"))
+
+	*clock = clock.Add(time.Minute)
+	primary.fail = false
+
+	// The successful trial closes the circuit and replays the spool
+	assert.NoError(t, breaker.Put("other.txt", []byte("other")))
+	assert.Equal(t, BreakerClosed, breaker.State())
+	assert.Equal(t, 0, breaker.Pending())
+
+	assert.Equal(t, "one\ntwo\n", readString(t, breaker, "log.txt"))
+
+	assert.Equal(t, "new", readString(t, memory, "new.txt"))
+	_, err := memory.Read("old.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+
+	paths, _ := fallback.List("")
+	assert.Empty(t, paths)
+}
+
+func TestBreakerDriverReplayConflicts(t *testing.T) {
+	memory := NewMemoryDriver()
+	memory.Write("a.txt", []byte("primary"))
+
+	primary := &failingDriver{Driver: memory, fail: true}
+	fallback := NewMemoryDriver()
+	breaker, clock := newTestBreakerDriver(primary, BreakerOptions{
+		MinRequests: 1,
+		OpenTimeout: time.Minute,
+		Fallback:    fallback,
+	})
+
+	breaker.Read("a.txt")
+	assert.NoError(t, breaker.Write("a.txt", []byte("spooled")))
+
+	*clock = clock.Add(time.Minute)
+	primary.fail = false
+
+	// The spooled Write must not clobber the file the primary already has
+	err := breaker.Replay()
+	assert.True(t, goerrors.Is(err, errors.ErrFileExists))
+	assert.Equal(t, 0, breaker.Pending())
+	assert.Equal(t, "primary", readString(t, memory, "a.txt"))
+
+	conflicts := breaker.Conflicts()
+	if assert.Len(t, conflicts, 1) {
+		assert.True(t, goerrors.Is(conflicts[0], errors.ErrFileExists))
+	}
+}
+
+func TestBreakerDriverReplayRetry(t *testing.T) {
+	primary := &failingDriver{Driver: NewMemoryDriver(), fail: true}
+	breaker, clock := newTestBreakerDriver(primary, BreakerOptions{
+		MinRequests: 1,
+		OpenTimeout: time.Minute,
+		Fallback:    NewMemoryDriver(),
+	})
+
+	breaker.Read("a.txt")
+	assert.NoError(t, breaker.Put("a.txt", []byte("1")))
+
+	// The trial replays first, fails and keeps the change spooled behind
+	// the older one
+	*clock = clock.Add(time.Minute)
+	assert.NoError(t, breaker.Put("a.txt", []byte("2")))
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.Equal(t, 2, breaker.Pending())
+
+	*clock = clock.Add(time.Minute)
+	primary.fail = false
+
+	assert.Equal(t, "2", readString(t, breaker, "a.txt"))
+	assert.Equal(t, BreakerClosed, breaker.State())
+	assert.Equal(t, 0, breaker.Pending())
+}
+
+func TestBreakerDriverPartialUpdate(t *testing.T) {
+	memory := NewMemoryDriver()
+	memory.Write("log.txt", []byte("one\n"))
+
+	primary := &failingDriver{Driver: memory, fail: true}
+	breaker, _ := newTestBreakerDriver(primary, BreakerOptions{
+		MinRequests: 1,
+		OpenTimeout: time.Minute,
+		Fallback:    NewMemoryDriver(),
+	})
+
+	breaker.Read("log.txt")
+	assert.NoError(t, breaker.Update("log.txt", []byte("two\n"), false))
+
+	// The fallback only has the appended part, not the whole file
+	_, err := breaker.Read("log.txt")
+	assert.Equal(t, errors.ErrCircuitOpen, err)
+
+	assert.NoError(t, breaker.Put("log.txt", []byte("three\n")))
+	assert.Equal(t, "three\n", readString(t, breaker, "log.txt"))
+}
+
+func TestBreakerDriverSlowFallback(t *testing.T) {
+	fallback := &blockingPutDriver{
+		Driver:  NewMemoryDriver(),
+		path:    "a.txt",
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	primary := &failingDriver{Driver: NewMemoryDriver(), fail: true}
+	breaker, _ := newTestBreakerDriver(primary, BreakerOptions{
+		MinRequests: 1,
+		OpenTimeout: time.Minute,
+		Fallback:    fallback,
+	})
+
+	breaker.Read("a.txt")
+
+	done := make(chan error)
+	go func() {
+		done <- breaker.Put("a.txt", []byte("a"))
+	}()
+	<-fallback.started
+
+	// Test the circuit state does not wait for the spool's disk I/O
+	assert.Equal(t, BreakerOpen, breaker.State())
+	assert.Equal(t, 0, breaker.Pending())
+	_, err := breaker.Read("b.txt")
+	assert.Equal(t, errors.ErrCircuitOpen, err)
+
+	close(fallback.release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, 1, breaker.Pending())
+}
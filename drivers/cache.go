@@ -0,0 +1,281 @@
+package drivers
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"sync"
+	"time"
+)
+
+// CacheDriver serves reads from a cache driver (usually a MemoryDriver or a
+// LocalDriver) and falls back to the wrapped driver on a miss. Changes made
+// through the CacheDriver invalidate the cached copy.
+//
+// The LRU bookkeeping is guarded by mutex and never waits for the cache
+// driver. Changes to the cache driver are serialized by writes, so a
+// stale copy cannot land after a newer one.
+type CacheDriver struct {
+	driver Driver
+	cache  Driver
+	opts   CacheOptions
+
+	entries    map[string]*list.Element
+	lru        *list.List
+	size       int64
+	generation uint64
+	stats      CacheStats
+	mutex      sync.Mutex
+	writes     sync.Mutex
+}
+
+type CacheOptions struct {
+	MaxBytes int64         // total cached bytes before evicting, 0 for no limit
+	TTL      time.Duration // how long an entry stays fresh, 0 for no expiry
+}
+
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Bytes     int64
+	Entries   int
+}
+
+type cacheEntry struct {
+	path      string
+	size      int64
+	expiresAt time.Time
+}
+
+func NewCacheDriver(driver Driver, cache Driver, opts CacheOptions) *CacheDriver {
+	return &CacheDriver{
+		driver:  driver,
+		cache:   cache,
+		opts:    opts,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (d *CacheDriver) Read(path string) (io.ReadCloser, error) {
+	if reader, ok := d.readCached(path); ok {
+		return reader, nil
+	}
+
+	d.mutex.Lock()
+	d.stats.Misses++
+	generation := d.generation
+	d.mutex.Unlock()
+
+	reader, err := d.driver.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	d.store(path, data, generation)
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (d *CacheDriver) Write(path string, data []byte) error {
+	defer d.Invalidate(path)
+	return d.driver.Write(path, data)
+}
+
+func (d *CacheDriver) Put(path string, data []byte) error {
+	defer d.Invalidate(path)
+	return d.driver.Put(path, data)
+}
+
+func (d *CacheDriver) Delete(path string) error {
+	defer d.Invalidate(path)
+	return d.driver.Delete(path)
+}
+
+func (d *CacheDriver) Update(path string, data []byte, prepend bool) error {
+	defer d.Invalidate(path)
+	return d.driver.Update(path, data, prepend)
+}
+
+func (d *CacheDriver) List(prefix string) ([]string, error) {
+	return listFiles(d.driver, prefix)
+}
+
+// Invalidate drops the cached copy of path, if any.
+func (d *CacheDriver) Invalidate(path string) {
+	d.mutex.Lock()
+	d.generation++
+	element, exists := d.entries[path]
+	if exists {
+		d.unlink(element)
+	}
+	d.mutex.Unlock()
+
+	if exists {
+		d.drop(path)
+	}
+}
+
+// Purge empties the cache.
+func (d *CacheDriver) Purge() {
+	d.mutex.Lock()
+	d.generation++
+	paths := make([]string, 0, d.lru.Len())
+	for d.lru.Len() > 0 {
+		paths = append(paths, d.unlink(d.lru.Back()))
+	}
+	d.mutex.Unlock()
+
+	d.drop(paths...)
+}
+
+func (d *CacheDriver) Stats() CacheStats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	stats := d.stats
+	stats.Bytes = d.size
+	stats.Entries = d.lru.Len()
+
+	return stats
+}
+
+func (d *CacheDriver) readCached(path string) (io.ReadCloser, bool) {
+	d.mutex.Lock()
+	element, exists := d.entries[path]
+	if !exists {
+		d.mutex.Unlock()
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if !entry.expiresAt.IsZero() && time.Now().After(entry.expiresAt) {
+		d.unlink(element)
+		d.mutex.Unlock()
+
+		d.drop(path)
+		return nil, false
+	}
+	d.mutex.Unlock()
+
+	reader, err := d.cache.Read(path)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err != nil {
+		// The cached copy went missing underneath us
+		if d.entries[path] == element {
+			d.unlink(element)
+		}
+		return nil, false
+	}
+
+	if d.entries[path] == element {
+		d.lru.MoveToFront(element)
+	}
+	d.stats.Hits++
+
+	return reader, true
+}
+
+func (d *CacheDriver) store(path string, data []byte, generation uint64) {
+	size := int64(len(data))
+	if d.opts.MaxBytes > 0 && size > d.opts.MaxBytes {
+		return
+	}
+
+	d.writes.Lock()
+	defer d.writes.Unlock()
+
+	// Something changed while we were reading from the driver, so the data
+	// may already be stale
+	if !d.current(generation) {
+		return
+	}
+
+	if err := d.cache.Put(path, data); err != nil {
+		return
+	}
+
+	d.mutex.Lock()
+
+	// The data went stale during the Put, take it out again
+	if d.generation != generation {
+		d.mutex.Unlock()
+		d.dropLocked(path)
+		return
+	}
+
+	if element, exists := d.entries[path]; exists {
+		d.unlink(element)
+	}
+
+	entry := &cacheEntry{
+		path: path,
+		size: size,
+	}
+	if d.opts.TTL > 0 {
+		entry.expiresAt = time.Now().Add(d.opts.TTL)
+	}
+
+	d.entries[path] = d.lru.PushFront(entry)
+	d.size += size
+
+	evicted := make([]string, 0)
+	for d.opts.MaxBytes > 0 && d.size > d.opts.MaxBytes {
+		evicted = append(evicted, d.unlink(d.lru.Back()))
+		d.stats.Evictions++
+	}
+	d.mutex.Unlock()
+
+	d.dropLocked(evicted...)
+}
+
+func (d *CacheDriver) current(generation uint64) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.generation == generation
+}
+
+// unlink removes an entry from the bookkeeping and returns its path. The
+// cached copy is deleted by drop once the mutex is released.
+func (d *CacheDriver) unlink(element *list.Element) string {
+	entry := element.Value.(*cacheEntry)
+
+	d.lru.Remove(element)
+	delete(d.entries, entry.path)
+	d.size -= entry.size
+
+	return entry.path
+}
+
+// drop deletes the cached copies of paths that no longer have an entry.
+func (d *CacheDriver) drop(paths ...string) {
+	d.writes.Lock()
+	defer d.writes.Unlock()
+
+	d.dropLocked(paths...)
+}
+
+// dropLocked is drop for callers that already hold writes. Entries can
+// only come back under writes, so a path without one is safe to delete.
+func (d *CacheDriver) dropLocked(paths ...string) {
+	for _, path := range paths {
+		d.mutex.Lock()
+		_, exists := d.entries[path]
+		d.mutex.Unlock()
+
+		if !exists {
+			d.cache.Delete(path)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingDriver struct {
+	Driver
+	reads int
+}
+
+func (d *countingDriver) Read(path string) (io.ReadCloser, error) {
+	d.reads++
+	return d.Driver.Read(path)
+}
+
+func TestCacheDriver(t *testing.T) {
+	backend := &countingDriver{Driver: NewMemoryDriver()}
+	cache := NewMemoryDriver()
+	driver := NewCacheDriver(backend, cache, CacheOptions{})
+
+	err := driver.Write("test.txt", []byte("Hello, Cache!"))
+	assert.NoError(t, err)
+
+	// Test the first Read misses and the second hits
+	assert.Equal(t, "Hello, Cache!", readString(t, driver, "test.txt"))
+	assert.Equal(t, "Hello, Cache!", readString(t, driver, "test.txt"))
+	assert.Equal(t, 1, backend.reads)
+	assert.Equal(t, "Hello, Cache!", readString(t, cache, "test.txt"))
+
+	stats := driver.Stats()
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.Equal(t, int64(13), stats.Bytes)
+	assert.Equal(t, 1, stats.Entries)
+
+	// Test Put invalidates
+	err = driver.Put("test.txt", []byte("New data"))
+	assert.NoError(t, err)
+	assert.Equal(t, "New data", readString(t, driver, "test.txt"))
+	assert.Equal(t, 2, backend.reads)
+
+	// Test Update invalidates
+	err = driver.Update("test.txt", []byte(" Appended"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "New data Appended", readString(t, driver, "test.txt"))
+	assert.Equal(t, 3, backend.reads)
+
+	// Test Delete invalidates
+	err = driver.Delete("test.txt")
+	assert.NoError(t, err)
+
+	_, err = driver.Read("test.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+
+	_, err = cache.Read("test.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+}
+
+func TestCacheDriverEviction(t *testing.T) {
+	backend := &countingDriver{Driver: NewMemoryDriver()}
+	driver := NewCacheDriver(backend, NewMemoryDriver(), CacheOptions{MaxBytes: 10})
+
+	assert.NoError(t, backend.Write("a.txt", []byte("aaaa")))
+	assert.NoError(t, backend.Write("b.txt", []byte("bbbb")))
+	assert.NoError(t, backend.Write("c.txt", []byte("cccc")))
+	assert.NoError(t, backend.Write("big.txt", []byte("too big to cache")))
+
+	readString(t, driver, "a.txt")
+	readString(t, driver, "b.txt")
+
+	// Touch a.txt so b.txt becomes the least recently used
+	readString(t, driver, "a.txt")
+	readString(t, driver, "c.txt")
+
+	stats := driver.Stats()
+	assert.Equal(t, int64(1), stats.Evictions)
+	assert.Equal(t, int64(8), stats.Bytes)
+
+	backend.reads = 0
+	readString(t, driver, "a.txt")
+	assert.Equal(t, 0, backend.reads)
+	readString(t, driver, "b.txt")
+	assert.Equal(t, 1, backend.reads)
+
+	// Test files larger than the cache are never stored
+	readString(t, driver, "big.txt")
+	readString(t, driver, "big.txt")
+	assert.Equal(t, 3, backend.reads)
+
+	// Test Purge
+	driver.Purge()
+	assert.Equal(t, 0, driver.Stats().Entries)
+	assert.Equal(t, int64(0), driver.Stats().Bytes)
+}
+
+func TestCacheDriverTTL(t *testing.T) {
+	backend := &countingDriver{Driver: NewMemoryDriver()}
+	driver := NewCacheDriver(backend, NewMemoryDriver(), CacheOptions{TTL: 20 * time.Millisecond})
+
+	assert.NoError(t, backend.Write("test.txt", []byte("test")))
+
+	readString(t, driver, "test.txt")
+	readString(t, driver, "test.txt")
+	assert.Equal(t, 1, backend.reads)
+
+	time.Sleep(30 * time.Millisecond)
+
+	readString(t, driver, "test.txt")
+	assert.Equal(t, 2, backend.reads)
+}
+
+// blockingPutDriver holds Puts of one path until release is closed.
+type blockingPutDriver struct {
+	Driver
+	path    string
+	started chan struct{}
+	release chan struct{}
+}
+
+func (d *blockingPutDriver) Put(path string, data []byte) error {
+	if path == d.path {
+		close(d.started)
+		<-d.release
+	}
+	return d.Driver.Put(path, data)
+}
+
+func TestCacheDriverSlowCache(t *testing.T) {
+	backend := NewMemoryDriver()
+	backend.Write("a.txt", []byte("a"))
+	backend.Write("b.txt", []byte("b"))
+
+	cache := &blockingPutDriver{
+		Driver:  NewMemoryDriver(),
+		path:    "b.txt",
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	driver := NewCacheDriver(backend, cache, CacheOptions{})
+	assert.Equal(t, "a", readString(t, driver, "a.txt"))
+
+	done := make(chan string)
+	go func() {
+		reader, _ := driver.Read("b.txt")
+		data, _ := io.ReadAll(reader)
+		done <- string(data)
+	}()
+	<-cache.started
+
+	// Test hits and the bookkeeping do not wait for the stuck Put
+	assert.Equal(t, "a", readString(t, driver, "a.txt"))
+	assert.Equal(t, int64(1), driver.Stats().Hits)
+
+	close(cache.release)
+	assert.Equal(t, "b", <-done)
+	assert.Equal(t, 2, driver.Stats().Entries)
+}
@@ -0,0 +1,284 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Interaction is one recorded call and its result.
+type Interaction struct {
+	Operation string   `json:"operation"` // READ, WRITE, PUT, DELETE, UPDATE or LIST
+	Path      string   `json:"path"`
+	Data      []byte   `json:"data,omitempty"`
+	Prepend   bool     `json:"prepend,omitempty"`
+	Content   []byte   `json:"content,omitempty"` // what READ returned
+	Paths     []string `json:"paths,omitempty"`   // what LIST returned
+	Error     string   `json:"error,omitempty"`
+	Sentinel  string   `json:"sentinel,omitempty"` // the known error Error wraps
+}
+
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// cassetteErrors are the sentinels a recorded error is matched against with
+// errors.Is, so a replayed error still matches the same sentinel.
+var cassetteErrors = []error{
+	errors.ErrFileNotFound,
+	errors.ErrFileExists,
+	errors.ErrPermissionDenied,
+	errors.ErrNotSupported,
+	errors.ErrNotMounted,
+	errors.ErrCorruptData,
+	errors.ErrQuotaExceeded,
+	errors.ErrCircuitOpen,
+	errors.ErrUnexpectedCall,
+	io.ErrShortWrite,
+	io.ErrUnexpectedEOF,
+	context.DeadlineExceeded,
+	context.Canceled,
+}
+
+// RecordingDriver passes calls through to the wrapped driver and records
+// them with their results. Save writes the cassette for a ReplayDriver.
+type RecordingDriver struct {
+	driver   Driver
+	path     string
+	cassette Cassette
+	mutex    sync.Mutex
+}
+
+func NewRecordingDriver(driver Driver, cassettePath string) *RecordingDriver {
+	return &RecordingDriver{
+		driver:   driver,
+		path:     cassettePath,
+		cassette: Cassette{Interactions: make([]Interaction, 0)},
+	}
+}
+
+// Read reads the whole file to record it and returns a reader over the
+// recorded content.
+func (d *RecordingDriver) Read(path string) (io.ReadCloser, error) {
+	interaction := Interaction{Operation: "READ", Path: path}
+
+	reader, err := d.driver.Read(path)
+	if err == nil {
+		interaction.Content, err = io.ReadAll(reader)
+		reader.Close()
+	}
+
+	d.record(interaction, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(interaction.Content)), nil
+}
+
+func (d *RecordingDriver) Write(path string, data []byte) error {
+	err := d.driver.Write(path, data)
+	d.record(Interaction{Operation: "WRITE", Path: path, Data: data}, err)
+
+	return err
+}
+
+func (d *RecordingDriver) Put(path string, data []byte) error {
+	err := d.driver.Put(path, data)
+	d.record(Interaction{Operation: "PUT", Path: path, Data: data}, err)
+
+	return err
+}
+
+func (d *RecordingDriver) Delete(path string) error {
+	err := d.driver.Delete(path)
+	d.record(Interaction{Operation: "DELETE", Path: path}, err)
+
+	return err
+}
+
+func (d *RecordingDriver) Update(path string, data []byte, prepend bool) error {
+	err := d.driver.Update(path, data, prepend)
+	d.record(Interaction{Operation: "UPDATE", Path: path, Data: data, Prepend: prepend}, err)
+
+	return err
+}
+
+func (d *RecordingDriver) List(prefix string) ([]string, error) {
+	paths, err := listFiles(d.driver, prefix)
+	d.record(Interaction{Operation: "LIST", Path: prefix, Paths: paths}, err)
+
+	return paths, err
+}
+
+// Save writes everything recorded so far to the cassette file.
+func (d *RecordingDriver) Save() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	data, err := json.MarshalIndent(d.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(d.path, data, 0644)
+}
+
+func (d *RecordingDriver) record(interaction Interaction, err error) {
+	if err != nil {
+		interaction.Error = err.Error()
+
+		for _, sentinel := range cassetteErrors {
+			if goerrors.Is(err, sentinel) {
+				interaction.Sentinel = sentinel.Error()
+				break
+			}
+		}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.cassette.Interactions = append(d.cassette.Interactions, interaction)
+}
+
+// ReplayDriver answers calls from a cassette without touching storage.
+// Calls must arrive in the recorded order with the recorded arguments, any
+// other call fails with ErrUnexpectedCall.
+type ReplayDriver struct {
+	interactions []Interaction
+	next         int
+	mutex        sync.Mutex
+}
+
+func NewReplayDriver(cassettePath string) (*ReplayDriver, error) {
+	data, err := os.ReadFile(cassettePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var cassette Cassette
+	if err := json.Unmarshal(data, &cassette); err != nil {
+		return nil, err
+	}
+
+	return &ReplayDriver{interactions: cassette.Interactions}, nil
+}
+
+func (d *ReplayDriver) Read(path string) (io.ReadCloser, error) {
+	interaction, err := d.replay(Interaction{Operation: "READ", Path: path})
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(interaction.Content)), nil
+}
+
+func (d *ReplayDriver) Write(path string, data []byte) error {
+	_, err := d.replay(Interaction{Operation: "WRITE", Path: path, Data: data})
+	return err
+}
+
+func (d *ReplayDriver) Put(path string, data []byte) error {
+	_, err := d.replay(Interaction{Operation: "PUT", Path: path, Data: data})
+	return err
+}
+
+func (d *ReplayDriver) Delete(path string) error {
+	_, err := d.replay(Interaction{Operation: "DELETE", Path: path})
+	return err
+}
+
+func (d *ReplayDriver) Update(path string, data []byte, prepend bool) error {
+	_, err := d.replay(Interaction{Operation: "UPDATE", Path: path, Data: data, Prepend: prepend})
+	return err
+}
+
+func (d *ReplayDriver) List(prefix string) ([]string, error) {
+	interaction, err := d.replay(Interaction{Operation: "LIST", Path: prefix})
+	if err != nil {
+		return nil, err
+	}
+
+	return interaction.Paths, nil
+}
+
+// Done reports an error when recorded interactions were never replayed.
+func (d *ReplayDriver) Done() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if remaining := len(d.interactions) - d.next; remaining > 0 {
+		next := d.interactions[d.next]
+		return fmt.Errorf("%d recorded calls not replayed, next is %s %s", remaining, next.Operation, next.Path)
+	}
+
+	return nil
+}
+
+func (d *ReplayDriver) replay(call Interaction) (Interaction, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.next >= len(d.interactions) {
+		return Interaction{}, fmt.Errorf("%w: %s %s after the end of the cassette", errors.ErrUnexpectedCall, call.Operation, call.Path)
+	}
+
+	interaction := d.interactions[d.next]
+	if interaction.Operation != call.Operation ||
+		interaction.Path != call.Path ||
+		!bytes.Equal(interaction.Data, call.Data) ||
+		interaction.Prepend != call.Prepend {
+		return Interaction{}, fmt.Errorf("%w: got %s %s, recorded %s %s", errors.ErrUnexpectedCall,
+			call.Operation, call.Path, interaction.Operation, interaction.Path)
+	}
+	d.next++
+
+	if interaction.Error != "" {
+		return interaction, cassetteError(interaction.Error, interaction.Sentinel)
+	}
+
+	return interaction, nil
+}
+
+// cassetteError rebuilds a recorded error. Sentinels come back as
+// themselves, wrapped errors as their message wrapping the sentinel.
+func cassetteError(message, sentinel string) error {
+	if sentinel == "" {
+		sentinel = message
+	}
+
+	for _, known := range cassetteErrors {
+		if known.Error() != sentinel {
+			continue
+		}
+
+		if message == sentinel {
+			return known
+		}
+		return &replayedError{message: message, sentinel: known}
+	}
+
+	return goerrors.New(message)
+}
+
+// replayedError carries a recorded message and still matches the sentinel
+// the original error wrapped.
+type replayedError struct {
+	message  string
+	sentinel error
+}
+
+func (e *replayedError) Error() string {
+	return e.message
+}
+
+func (e *replayedError) Unwrap() error {
+	return e.sentinel
+}
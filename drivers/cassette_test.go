@@ -0,0 +1,109 @@
+package drivers
+
+import (
+	"context"
+	goerrors "errors"
+	"github.com/vanvanni/lampofs/errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func recordTestCassette(t *testing.T) string {
+	t.Helper()
+
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	recorder := NewRecordingDriver(NewMemoryDriver(), cassette)
+
+	assert.NoError(t, recorder.Write("a.txt", []byte("hello")))
+	assert.Equal(t, errors.ErrFileExists, recorder.Write("a.txt", []byte("again")))
+	assert.NoError(t, recorder.Update("a.txt", []byte(" world"), false))
+	assert.Equal(t, "hello world", readString(t, recorder, "a.txt"))
+
+	paths, err := recorder.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, paths)
+
+	assert.NoError(t, recorder.Save())
+	return cassette
+}
+
+func TestReplayDriver(t *testing.T) {
+	replay, err := NewReplayDriver(recordTestCassette(t))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, replay.Write("a.txt", []byte("hello")))
+	assert.Equal(t, errors.ErrFileExists, replay.Write("a.txt", []byte("again")))
+	assert.Error(t, replay.Done())
+	assert.NoError(t, replay.Update("a.txt", []byte(" world"), false))
+	assert.Equal(t, "hello world", readString(t, replay, "a.txt"))
+
+	paths, err := replay.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.txt"}, paths)
+
+	assert.NoError(t, replay.Done())
+}
+
+func TestReplayDriverUnexpectedCall(t *testing.T) {
+	replay, err := NewReplayDriver(recordTestCassette(t))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Different data than recorded
+	err = replay.Write("a.txt", []byte("bye"))
+	assert.True(t, goerrors.Is(err, errors.ErrUnexpectedCall))
+
+	// A mismatch does not consume the recorded call
+	assert.NoError(t, replay.Write("a.txt", []byte("hello")))
+
+	err = replay.Delete("a.txt")
+	assert.True(t, goerrors.Is(err, errors.ErrUnexpectedCall))
+}
+
+func TestReplayDriverEndOfCassette(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	assert.NoError(t, NewRecordingDriver(NewMemoryDriver(), cassette).Save())
+
+	replay, err := NewReplayDriver(cassette)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = replay.Read("a.txt")
+	assert.True(t, goerrors.Is(err, errors.ErrUnexpectedCall))
+}
+
+func TestReplayDriverWrappedErrors(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+
+	quota := NewQuotaDriver(NewMemoryDriver(), QuotaOptions{MaxFileSize: 2})
+	faults, _ := newTestFaultDriver(quota, FaultOptions{
+		Faults: []Fault{{Kind: FaultTimeout, Operations: []string{"DELETE"}}},
+	})
+	recorder := NewRecordingDriver(faults, cassette)
+
+	quotaErr := recorder.Put("big.txt", []byte("too big"))
+	assert.ErrorIs(t, quotaErr, errors.ErrQuotaExceeded)
+	timeoutErr := recorder.Delete("big.txt")
+	assert.ErrorIs(t, timeoutErr, context.DeadlineExceeded)
+	assert.NoError(t, recorder.Save())
+
+	replay, err := NewReplayDriver(cassette)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Test replayed errors keep their message and still match the sentinel
+	err = replay.Put("big.txt", []byte("too big"))
+	assert.ErrorIs(t, err, errors.ErrQuotaExceeded)
+	assert.EqualError(t, err, quotaErr.Error())
+
+	err = replay.Delete("big.txt")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, timeoutErr.Error())
+}
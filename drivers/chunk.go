@@ -0,0 +1,387 @@
+package drivers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+const chunksDir = ".chunks"
+
+type ChunkOptions struct {
+	ChunkSize   int // bytes per chunk, defaults to 8 MiB
+	Concurrency int // chunks uploaded in parallel, defaults to 4
+}
+
+// ChunkDriver splits files into fixed-size chunks stored as separate
+// objects under .chunks/<path>/<n>-<generation>. The file path itself holds
+// a small JSON manifest. Chunks are never overwritten: every change writes
+// under a new generation and only takes effect once the manifest points at
+// it, so a failed change leaves the file as it was. Appending only rewrites
+// the last partial chunk and adds new ones, and ReadRange only fetches the
+// chunks it needs.
+type ChunkDriver struct {
+	driver Driver
+	opts   ChunkOptions
+}
+
+type chunkManifest struct {
+	Size       int64   `json:"size"`
+	ChunkSize  int     `json:"chunk_size"`
+	Generation int64   `json:"generation"`
+	Chunks     []int64 `json:"chunks"` // the generation each chunk was written in
+}
+
+func NewChunkDriver(driver Driver, opts ChunkOptions) *ChunkDriver {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 8 * 1024 * 1024
+	}
+
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+
+	return &ChunkDriver{
+		driver: driver,
+		opts:   opts,
+	}
+}
+
+func (d *ChunkDriver) Read(path string) (io.ReadCloser, error) {
+	manifest, err := d.manifest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chunkReader{
+		driver:    d,
+		path:      path,
+		chunks:    manifest.Chunks,
+		remaining: manifest.Size,
+	}, nil
+}
+
+// ReadRange reads length bytes starting at offset, fetching only the
+// chunks that overlap the range. A negative length reads to the end.
+func (d *ChunkDriver) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	manifest, err := d.manifest(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if offset < 0 || offset > manifest.Size {
+		return nil, fmt.Errorf("offset %d out of range for %d bytes", offset, manifest.Size)
+	}
+
+	if length < 0 || offset+length > manifest.Size {
+		length = manifest.Size - offset
+	}
+
+	if length == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	chunkSize := int64(manifest.ChunkSize)
+	first := int(offset / chunkSize)
+	last := int((offset + length - 1) / chunkSize)
+
+	return &chunkReader{
+		driver:    d,
+		path:      path,
+		chunks:    manifest.Chunks[:last+1],
+		next:      first,
+		skip:      offset - int64(first)*chunkSize,
+		remaining: length,
+	}, nil
+}
+
+func (d *ChunkDriver) Write(path string, data []byte) error {
+	_, err := d.manifest(path)
+	if err == nil {
+		return errors.ErrFileExists
+	}
+
+	if err != errors.ErrFileNotFound {
+		return err
+	}
+
+	return d.Put(path, data)
+}
+
+func (d *ChunkDriver) Put(path string, data []byte) error {
+	previous, err := d.manifest(path)
+	if err != nil && err != errors.ErrFileNotFound {
+		return err
+	}
+
+	manifest := chunkManifest{
+		Size:       int64(len(data)),
+		ChunkSize:  d.opts.ChunkSize,
+		Generation: previous.Generation + 1,
+	}
+
+	if err := d.commit(path, &manifest, 0, splitChunks(data, d.opts.ChunkSize)); err != nil {
+		return err
+	}
+
+	return d.deleteChunks(path, previous.Chunks, 0)
+}
+
+func (d *ChunkDriver) Delete(path string) error {
+	manifest, err := d.manifest(path)
+	if err != nil {
+		return err
+	}
+
+	if err := d.driver.Delete(path); err != nil {
+		return err
+	}
+
+	return d.deleteChunks(path, manifest.Chunks, 0)
+}
+
+// Update appends by topping up the last chunk and adding new ones, so the
+// rest of the file is never rewritten. Prepending shifts every byte and
+// rewrites the whole file.
+func (d *ChunkDriver) Update(path string, data []byte, prepend bool) error {
+	manifest, err := d.manifest(path)
+	if err == errors.ErrFileNotFound {
+		return d.Put(path, data)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if prepend || manifest.ChunkSize != d.opts.ChunkSize {
+		reader, err := d.Read(path)
+		if err != nil {
+			return err
+		}
+
+		existingData, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+
+		return d.Put(path, applyUpdate(existingData, data, prepend))
+	}
+
+	previous := manifest.Chunks
+	start := len(previous)
+	tail := data
+
+	if partial := int(manifest.Size % int64(manifest.ChunkSize)); partial > 0 {
+		start--
+
+		lastChunk, err := d.readChunk(path, start, previous[start])
+		if err != nil {
+			return err
+		}
+
+		tail = append(lastChunk, data...)
+	}
+
+	manifest.Size += int64(len(data))
+	manifest.Generation++
+	manifest.Chunks = previous[:start:start]
+
+	if err := d.commit(path, &manifest, start, splitChunks(tail, manifest.ChunkSize)); err != nil {
+		return err
+	}
+
+	// Only the replaced partial chunk is left over
+	return d.deleteChunks(path, previous[start:], start)
+}
+
+func (d *ChunkDriver) List(prefix string) ([]string, error) {
+	paths, err := listFiles(d.driver, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if !strings.HasPrefix(path, chunksDir+"/") {
+			visible = append(visible, path)
+		}
+	}
+
+	return visible, nil
+}
+
+func (d *ChunkDriver) manifest(path string) (chunkManifest, error) {
+	var manifest chunkManifest
+
+	reader, err := d.driver.Read(path)
+	if err != nil {
+		return manifest, err
+	}
+	defer reader.Close()
+
+	if err := json.NewDecoder(reader).Decode(&manifest); err != nil || manifest.ChunkSize <= 0 {
+		return manifest, errors.ErrCorruptData
+	}
+
+	return manifest, nil
+}
+
+// commit uploads chunks as indexes start, start+1, ... under the
+// manifest's generation and then writes the manifest that points at them.
+// On failure the new chunks are removed again and the old manifest stays.
+func (d *ChunkDriver) commit(path string, manifest *chunkManifest, start int, chunks [][]byte) error {
+	for range chunks {
+		manifest.Chunks = append(manifest.Chunks, manifest.Generation)
+	}
+	written := manifest.Chunks[start:]
+
+	err := d.putChunks(path, start, manifest.Generation, chunks)
+	if err == nil {
+		err = d.putManifest(path, *manifest)
+	}
+
+	if err != nil {
+		d.deleteChunks(path, written, start)
+		return err
+	}
+
+	return nil
+}
+
+func (d *ChunkDriver) putManifest(path string, manifest chunkManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Put(path, data)
+}
+
+// putChunks uploads chunks as indexes start, start+1, ... in parallel.
+func (d *ChunkDriver) putChunks(path string, start int, generation int64, chunks [][]byte) error {
+	var (
+		wg       sync.WaitGroup
+		mutex    sync.Mutex
+		firstErr error
+	)
+
+	slots := make(chan struct{}, d.opts.Concurrency)
+
+	for i, chunk := range chunks {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(index int, chunk []byte) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if err := d.driver.Put(chunkPath(path, index, generation), chunk); err != nil {
+				mutex.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mutex.Unlock()
+			}
+		}(start+i, chunk)
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// deleteChunks removes the chunks with the given generations, the first
+// one being index start.
+func (d *ChunkDriver) deleteChunks(path string, generations []int64, start int) error {
+	for i, generation := range generations {
+		err := d.driver.Delete(chunkPath(path, start+i, generation))
+		if err != nil && err != errors.ErrFileNotFound {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *ChunkDriver) readChunk(path string, index int, generation int64) ([]byte, error) {
+	reader, err := d.driver.Read(chunkPath(path, index, generation))
+	if err == errors.ErrFileNotFound {
+		// The manifest promised this chunk
+		return nil, errors.ErrCorruptData
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+func splitChunks(data []byte, size int) [][]byte {
+	chunks := make([][]byte, 0, len(data)/size+1)
+	for len(data) > 0 {
+		n := min(size, len(data))
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+
+	return chunks
+}
+
+func chunkPath(path string, index int, generation int64) string {
+	return fmt.Sprintf("%s/%s/%d-%d", chunksDir, strings.TrimPrefix(path, "/"), index, generation)
+}
+
+// chunkReader streams chunks from next on, one at a time, and stops after
+// remaining bytes. Chunks that end early are reported as ErrCorruptData.
+type chunkReader struct {
+	driver    *ChunkDriver
+	path      string
+	chunks    []int64
+	next      int
+	skip      int64
+	remaining int64
+	buf       []byte
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	for len(r.buf) == 0 {
+		if r.next >= len(r.chunks) {
+			return 0, errors.ErrCorruptData
+		}
+
+		chunk, err := r.driver.readChunk(r.path, r.next, r.chunks[r.next])
+		if err != nil {
+			return 0, err
+		}
+		r.next++
+
+		if r.skip > 0 {
+			chunk = chunk[min(r.skip, int64(len(chunk))):]
+			r.skip = 0
+		}
+
+		r.buf = chunk
+	}
+
+	n := copy(p[:min(int64(len(p)), r.remaining)], r.buf)
+	r.buf = r.buf[n:]
+	r.remaining -= int64(n)
+
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	r.buf = nil
+	r.remaining = 0
+	return nil
+}
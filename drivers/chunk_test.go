@@ -0,0 +1,166 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkDriver(t *testing.T) {
+	backend := NewMemoryDriver()
+	driver := NewChunkDriver(backend, ChunkOptions{ChunkSize: 4})
+
+	// Test Write splits into chunks
+	err := driver.Write("test.txt", []byte("Hello, Chunks!"))
+	assert.NoError(t, err)
+
+	paths, err := backend.List(".chunks/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		".chunks/test.txt/0-1",
+		".chunks/test.txt/1-1",
+		".chunks/test.txt/2-1",
+		".chunks/test.txt/3-1",
+	}, paths)
+
+	// Test Read joins the chunks
+	assert.Equal(t, "Hello, Chunks!", readString(t, driver, "test.txt"))
+	assert.Equal(t, errors.ErrFileExists, driver.Write("test.txt", []byte("x")))
+
+	// Test Update (append) keeps the full chunks
+	assert.NoError(t, backend.Put(".chunks/test.txt/0-1", []byte("HELL")))
+	assert.NoError(t, driver.Update("test.txt", []byte(" More"), false))
+	assert.Equal(t, "HELLo, Chunks! More", readString(t, driver, "test.txt"))
+
+	// Test Update (prepend) rewrites everything
+	assert.NoError(t, driver.Update("test.txt", []byte(">> "), true))
+	assert.Equal(t, ">> HELLo, Chunks! More", readString(t, driver, "test.txt"))
+
+	// Test Put with fewer chunks drops the extra ones
+	assert.NoError(t, driver.Put("test.txt", []byte("short")))
+	assert.Equal(t, "short", readString(t, driver, "test.txt"))
+
+	paths, err = backend.List(".chunks/")
+	assert.NoError(t, err)
+	assert.Len(t, paths, 2)
+
+	// Test empty files
+	assert.NoError(t, driver.Put("empty.txt", []byte{}))
+	assert.Equal(t, "", readString(t, driver, "empty.txt"))
+
+	assert.NoError(t, driver.Update("empty.txt", []byte("filled"), false))
+	assert.Equal(t, "filled", readString(t, driver, "empty.txt"))
+
+	// Test List hides the chunks
+	paths, err = driver.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"empty.txt", "test.txt"}, paths)
+
+	// Test Delete removes the chunks
+	assert.NoError(t, driver.Delete("test.txt"))
+
+	_, err = driver.Read("test.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+
+	paths, err = backend.List(".chunks/test.txt/")
+	assert.NoError(t, err)
+	assert.Empty(t, paths)
+}
+
+func TestChunkDriverReadRange(t *testing.T) {
+	backend := &countingDriver{Driver: NewMemoryDriver()}
+	driver := NewChunkDriver(backend, ChunkOptions{ChunkSize: 4, Concurrency: 2})
+
+	assert.NoError(t, driver.Put("test.txt", []byte("0123456789abcdef")))
+
+	// Test a range inside two chunks reads the manifest and two chunks
+	backend.reads = 0
+	reader, err := driver.ReadRange("test.txt", 6, 4)
+	assert.NoError(t, err)
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "6789", string(data))
+	assert.Equal(t, 3, backend.reads)
+
+	// Test a negative length reads to the end
+	reader, err = driver.ReadRange("test.txt", 13, -1)
+	assert.NoError(t, err)
+
+	data, err = io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "def", string(data))
+
+	// Test empty and invalid ranges
+	reader, err = driver.ReadRange("test.txt", 16, 10)
+	assert.NoError(t, err)
+	data, _ = io.ReadAll(reader)
+	assert.Empty(t, data)
+
+	_, err = driver.ReadRange("test.txt", 17, 1)
+	assert.Error(t, err)
+
+	// Test missing chunks are reported
+	assert.NoError(t, backend.Delete(".chunks/test.txt/2-1"))
+
+	reader, err = driver.Read("test.txt")
+	assert.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	assert.Equal(t, errors.ErrCorruptData, err)
+}
+
+// failingPutDriver fails Puts once failAfter of them went through.
+type failingPutDriver struct {
+	Driver
+	failAfter int
+	puts      int
+	mutex     sync.Mutex
+}
+
+func (d *failingPutDriver) Put(path string, data []byte) error {
+	d.mutex.Lock()
+	d.puts++
+	fail := d.failAfter >= 0 && d.puts > d.failAfter
+	d.mutex.Unlock()
+
+	if fail {
+		return errUnavailable
+	}
+	return d.Driver.Put(path, data)
+}
+
+func TestChunkDriverFailedChanges(t *testing.T) {
+	memory := NewMemoryDriver()
+	backend := &failingPutDriver{Driver: memory, failAfter: -1}
+	driver := NewChunkDriver(backend, ChunkOptions{ChunkSize: 4, Concurrency: 1})
+
+	assert.NoError(t, driver.Put("test.txt", []byte("abcdef")))
+
+	// Test a failed append leaves the file as it was
+	backend.puts, backend.failAfter = 0, 1
+	assert.Error(t, driver.Update("test.txt", []byte("XYZW"), false))
+	assert.Equal(t, "abcdef", readString(t, driver, "test.txt"))
+
+	// Test a failed Put leaves the file as it was
+	backend.puts, backend.failAfter = 0, 1
+	assert.Error(t, driver.Put("test.txt", []byte("1234567890")))
+	assert.Equal(t, "abcdef", readString(t, driver, "test.txt"))
+
+	// Test the new chunks were cleaned up
+	paths, err := memory.List(".chunks/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".chunks/test.txt/0-1", ".chunks/test.txt/1-1"}, paths)
+
+	backend.failAfter = -1
+	assert.NoError(t, driver.Update("test.txt", []byte("XYZW"), false))
+	assert.Equal(t, "abcdefXYZW", readString(t, driver, "test.txt"))
+
+	// Test reads stop at the manifest size
+	assert.NoError(t, memory.Put(".chunks/test.txt/2-4", []byte("ZW and more")))
+	assert.Equal(t, "abcdefXYZW", readString(t, driver, "test.txt"))
+}
@@ -0,0 +1,274 @@
+package drivers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	pathpkg "path"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const compressionMagic = "LMPZ"
+
+type Compression byte
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZstd
+)
+
+// CompressionRule selects the algorithm for paths matching Pattern. A
+// pattern without a slash is matched against the file name only, so "*.log"
+// covers logs in every directory.
+type CompressionRule struct {
+	Pattern   string
+	Algorithm Compression
+}
+
+// CompressDriver compresses files before they reach the wrapped driver and
+// decompresses them on Read. Each file starts with a small header naming
+// the algorithm, so rules can change without breaking existing files.
+// Files without the header are passed through as-is.
+type CompressDriver struct {
+	driver    Driver
+	algorithm Compression
+	rules     []CompressionRule
+
+	// The zstd encoder is created on first use, so drivers that never
+	// write zstd do not pay for it
+	zstd     *zstd.Encoder
+	zstdErr  error
+	zstdOnce sync.Once
+}
+
+func NewCompressDriver(driver Driver, algorithm Compression, rules ...CompressionRule) *CompressDriver {
+	return &CompressDriver{
+		driver:    driver,
+		algorithm: algorithm,
+		rules:     rules,
+	}
+}
+
+func (d *CompressDriver) Read(path string) (io.ReadCloser, error) {
+	reader, err := d.driver.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewReader(reader)
+
+	algorithm, compressed, err := readCompressionHeader(buffered)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	if !compressed {
+		return &compressReader{Reader: buffered, closers: []io.Closer{reader}}, nil
+	}
+
+	switch algorithm {
+	case CompressionNone:
+		return &compressReader{Reader: buffered, closers: []io.Closer{reader}}, nil
+	case CompressionGzip:
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			reader.Close()
+			return nil, errors.ErrCorruptData
+		}
+		return &compressReader{Reader: gz, closers: []io.Closer{gz, reader}}, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+		decoder := zr.IOReadCloser()
+		return &compressReader{Reader: decoder, closers: []io.Closer{decoder, reader}}, nil
+	}
+
+	reader.Close()
+	return nil, errors.ErrCorruptData
+}
+
+func (d *CompressDriver) Write(path string, data []byte) error {
+	compressed, err := d.compress(d.algorithmFor(path), data, true)
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Write(path, compressed)
+}
+
+func (d *CompressDriver) Put(path string, data []byte) error {
+	compressed, err := d.compress(d.algorithmFor(path), data, true)
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Put(path, compressed)
+}
+
+func (d *CompressDriver) Delete(path string) error {
+	return d.driver.Delete(path)
+}
+
+// Update appends by adding an independent frame after the existing ones,
+// which both gzip and zstd decode as one stream. Prepending has to
+// recompress the whole file.
+func (d *CompressDriver) Update(path string, data []byte, prepend bool) error {
+	algorithm, compressed, err := d.storedAlgorithm(path)
+	if err == errors.ErrFileNotFound {
+		return d.Put(path, data)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !prepend {
+		if !compressed {
+			return d.driver.Update(path, data, false)
+		}
+
+		frame, err := d.compress(algorithm, data, false)
+		if err != nil {
+			return err
+		}
+
+		return d.driver.Update(path, frame, false)
+	}
+
+	reader, err := d.Read(path)
+	if err != nil {
+		return err
+	}
+
+	existingData, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	newData := make([]byte, len(data)+len(existingData))
+	copy(newData, data)
+	copy(newData[len(data):], existingData)
+
+	if !compressed {
+		return d.driver.Put(path, newData)
+	}
+
+	recompressed, err := d.compress(algorithm, newData, true)
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Put(path, recompressed)
+}
+
+func (d *CompressDriver) List(prefix string) ([]string, error) {
+	return listFiles(d.driver, prefix)
+}
+
+func (d *CompressDriver) algorithmFor(path string) Compression {
+	path = strings.TrimPrefix(path, "/")
+
+	for _, rule := range d.rules {
+		name := path
+		if !strings.Contains(rule.Pattern, "/") {
+			name = pathpkg.Base(path)
+		}
+
+		if matched, _ := pathpkg.Match(rule.Pattern, name); matched {
+			return rule.Algorithm
+		}
+	}
+
+	return d.algorithm
+}
+
+func (d *CompressDriver) storedAlgorithm(path string) (Compression, bool, error) {
+	reader, err := d.driver.Read(path)
+	if err != nil {
+		return CompressionNone, false, err
+	}
+	defer reader.Close()
+
+	return readCompressionHeader(bufio.NewReader(reader))
+}
+
+func (d *CompressDriver) compress(algorithm Compression, data []byte, header bool) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if header {
+		buf.WriteString(compressionMagic)
+		buf.WriteByte(byte(algorithm))
+	}
+
+	switch algorithm {
+	case CompressionGzip:
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(data); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	case CompressionZstd:
+		encoder, err := d.zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(data, buf.Bytes()), nil
+	default:
+		buf.Write(data)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (d *CompressDriver) zstdEncoder() (*zstd.Encoder, error) {
+	d.zstdOnce.Do(func() {
+		d.zstd, d.zstdErr = zstd.NewWriter(nil)
+	})
+
+	return d.zstd, d.zstdErr
+}
+
+// readCompressionHeader consumes the header if there is one and reports
+// whether it was found.
+func readCompressionHeader(r *bufio.Reader) (Compression, bool, error) {
+	header, err := r.Peek(len(compressionMagic) + 1)
+	if err != nil && err != io.EOF {
+		return CompressionNone, false, err
+	}
+
+	if len(header) < len(compressionMagic)+1 || string(header[:len(compressionMagic)]) != compressionMagic {
+		return CompressionNone, false, nil
+	}
+
+	r.Discard(len(header))
+	return Compression(header[len(compressionMagic)]), true, nil
+}
+
+type compressReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *compressReader) Close() error {
+	var firstErr error
+	for _, closer := range r.closers {
+		if err := closer.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,88 @@
+package drivers
+
+import (
+	"bytes"
+	"github.com/vanvanni/lampofs/errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressDriver(t *testing.T) {
+	for _, algorithm := range []Compression{CompressionGzip, CompressionZstd} {
+		backend := NewMemoryDriver()
+		driver := NewCompressDriver(backend, algorithm)
+
+		// Test Write stores compressed data
+		testData := strings.Repeat("Hello, Compression! ", 100)
+		err := driver.Write("test.log", []byte(testData))
+		assert.NoError(t, err)
+		assert.Less(t, len(readString(t, backend, "test.log")), len(testData))
+
+		// Test Read decompresses
+		assert.Equal(t, testData, readString(t, driver, "test.log"))
+
+		// Test Update (append) adds a frame without rewriting
+		err = driver.Update("test.log", []byte("Appended"), false)
+		assert.NoError(t, err)
+		assert.Equal(t, testData+"Appended", readString(t, driver, "test.log"))
+
+		// Test Update (prepend) recompresses
+		err = driver.Update("test.log", []byte("Prepended "), true)
+		assert.NoError(t, err)
+		assert.Equal(t, "Prepended "+testData+"Appended", readString(t, driver, "test.log"))
+
+		// Test Update on a missing file creates it
+		err = driver.Update("new.log", []byte("new"), false)
+		assert.NoError(t, err)
+		assert.Equal(t, "new", readString(t, driver, "new.log"))
+
+		// Test Delete
+		err = driver.Delete("test.log")
+		assert.NoError(t, err)
+
+		_, err = driver.Read("test.log")
+		assert.Equal(t, errors.ErrFileNotFound, err)
+	}
+}
+
+func TestCompressDriverRules(t *testing.T) {
+	backend := NewMemoryDriver()
+	driver := NewCompressDriver(backend, CompressionNone,
+		CompressionRule{Pattern: "*.log", Algorithm: CompressionZstd},
+		CompressionRule{Pattern: "archive/*", Algorithm: CompressionGzip},
+	)
+
+	testData := []byte(strings.Repeat("compressible ", 50))
+	assert.NoError(t, driver.Put("logs/app.log", testData))
+	assert.NoError(t, driver.Put("archive/2024.tar", testData))
+	assert.NoError(t, driver.Put("image.png", testData))
+
+	// Test each file records its own algorithm
+	assert.Equal(t, byte(CompressionZstd), readString(t, backend, "logs/app.log")[4])
+	assert.Equal(t, byte(CompressionGzip), readString(t, backend, "archive/2024.tar")[4])
+	assert.Equal(t, byte(CompressionNone), readString(t, backend, "image.png")[4])
+
+	for _, path := range []string{"logs/app.log", "archive/2024.tar", "image.png"} {
+		assert.Equal(t, string(testData), readString(t, driver, path))
+	}
+
+	// Test uncompressed files still append in place
+	assert.NoError(t, driver.Update("image.png", []byte("!"), false))
+	assert.Equal(t, string(testData)+"!", readString(t, driver, "image.png"))
+
+	// Test files written without the wrapper pass through
+	assert.NoError(t, backend.Put("legacy.txt", []byte("raw")))
+	assert.Equal(t, "raw", readString(t, driver, "legacy.txt"))
+
+	assert.NoError(t, driver.Update("legacy.txt", []byte(" data"), false))
+	assert.Equal(t, "raw data", readString(t, driver, "legacy.txt"))
+
+	// Test corrupted frames are reported
+	raw := []byte(readString(t, backend, "archive/2024.tar"))
+	assert.NoError(t, backend.Put("archive/broken.tar", append(raw[:5], bytes.Repeat([]byte{0}, 10)...)))
+
+	_, err := driver.Read("archive/broken.tar")
+	assert.Equal(t, errors.ErrCorruptData, err)
+}
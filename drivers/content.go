@@ -0,0 +1,274 @@
+package drivers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/vanvanni/lampofs/errors"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	contentBlobsDir  = "blobs"
+	contentIndexPath = "index.json"
+)
+
+// ContentDriver stores every file as a blob named by the SHA-256 of its
+// content, so identical files share one blob. A path to hash index kept in
+// the backing driver maps paths to blobs, and a blob is deleted once no
+// path references it anymore.
+type ContentDriver struct {
+	driver Driver
+	index  map[string]string
+	refs   map[string]int
+	mutex  sync.Mutex
+}
+
+func NewContentDriver(driver Driver) (*ContentDriver, error) {
+	d := &ContentDriver{
+		driver: driver,
+		index:  make(map[string]string),
+		refs:   make(map[string]int),
+	}
+
+	reader, err := driver.Read(contentIndexPath)
+	if err == errors.ErrFileNotFound {
+		return d, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if err := json.NewDecoder(reader).Decode(&d.index); err != nil {
+		return nil, errors.ErrCorruptData
+	}
+
+	for _, sum := range d.index {
+		d.refs[sum]++
+	}
+
+	return d, nil
+}
+
+func (d *ContentDriver) Read(path string) (io.ReadCloser, error) {
+	d.mutex.Lock()
+	sum, exists := d.index[path]
+	d.mutex.Unlock()
+
+	if !exists {
+		return nil, errors.ErrFileNotFound
+	}
+
+	reader, err := d.driver.Read(blobPath(sum))
+	if err != nil {
+		return nil, err
+	}
+
+	return &verifyReader{
+		ReadCloser: reader,
+		hash:       sha256.New(),
+		expected:   sum,
+	}, nil
+}
+
+func (d *ContentDriver) Write(path string, data []byte) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, exists := d.index[path]; exists {
+		return errors.ErrFileExists
+	}
+
+	return d.store(path, data)
+}
+
+func (d *ContentDriver) Put(path string, data []byte) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.store(path, data)
+}
+
+func (d *ContentDriver) Delete(path string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	sum, exists := d.index[path]
+	if !exists {
+		return errors.ErrFileNotFound
+	}
+
+	delete(d.index, path)
+	if err := d.saveIndex(); err != nil {
+		d.index[path] = sum
+		return err
+	}
+
+	return d.release(sum)
+}
+
+func (d *ContentDriver) Update(path string, data []byte, prepend bool) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	sum, exists := d.index[path]
+	if !exists {
+		return d.store(path, data)
+	}
+
+	reader, err := d.driver.Read(blobPath(sum))
+	if err != nil {
+		return err
+	}
+
+	existingData, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	return d.store(path, applyUpdate(existingData, data, prepend))
+}
+
+func (d *ContentDriver) List(prefix string) ([]string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	paths := make([]string, 0)
+	for path := range d.index {
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// Hash returns the SHA-256 content hash stored for path.
+func (d *ContentDriver) Hash(path string) (string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	sum, exists := d.index[path]
+	if !exists {
+		return "", errors.ErrFileNotFound
+	}
+
+	return sum, nil
+}
+
+// GC deletes blobs that no path references, such as those left behind by
+// an interrupted operation. The backing driver must implement Lister.
+func (d *ContentDriver) GC() (int, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	paths, err := listFiles(d.driver, contentBlobsDir+"/")
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, path := range paths {
+		sum := path[strings.LastIndex(path, "/")+1:]
+		if d.refs[sum] > 0 {
+			continue
+		}
+
+		if err := d.driver.Delete(path); err != nil && err != errors.ErrFileNotFound {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+func (d *ContentDriver) store(path string, data []byte) error {
+	digest := sha256.Sum256(data)
+	sum := hex.EncodeToString(digest[:])
+
+	previous, existed := d.index[path]
+	if existed && previous == sum {
+		return nil
+	}
+
+	// Identical content is already stored, only the index changes
+	if d.refs[sum] == 0 {
+		if err := d.driver.Put(blobPath(sum), data); err != nil {
+			return err
+		}
+	}
+
+	d.index[path] = sum
+	if err := d.saveIndex(); err != nil {
+		if existed {
+			d.index[path] = previous
+		} else {
+			delete(d.index, path)
+		}
+		return err
+	}
+	d.refs[sum]++
+
+	if existed {
+		return d.release(previous)
+	}
+
+	return nil
+}
+
+func (d *ContentDriver) release(sum string) error {
+	d.refs[sum]--
+	if d.refs[sum] > 0 {
+		return nil
+	}
+
+	delete(d.refs, sum)
+
+	err := d.driver.Delete(blobPath(sum))
+	if err == errors.ErrFileNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func (d *ContentDriver) saveIndex() error {
+	data, err := json.Marshal(d.index)
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Put(contentIndexPath, data)
+}
+
+func blobPath(sum string) string {
+	return contentBlobsDir + "/" + sum[:2] + "/" + sum
+}
+
+// verifyReader fails the final read when the blob no longer matches its
+// hash.
+type verifyReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (r *verifyReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+
+	if err == io.EOF && hex.EncodeToString(r.hash.Sum(nil)) != r.expected {
+		return n, errors.ErrCorruptData
+	}
+
+	return n, err
+}
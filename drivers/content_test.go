@@ -0,0 +1,104 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContentDriver(t *testing.T) {
+	backend := NewMemoryDriver()
+	driver, err := NewContentDriver(backend)
+	assert.NoError(t, err)
+
+	// Test identical payloads share one blob
+	assert.NoError(t, driver.Write("a/invoice.pdf", []byte("attachment")))
+	assert.NoError(t, driver.Put("b/invoice.pdf", []byte("attachment")))
+	assert.NoError(t, driver.Put("c/other.pdf", []byte("other")))
+
+	blobs, err := backend.List("blobs/")
+	assert.NoError(t, err)
+	assert.Len(t, blobs, 2)
+
+	sumA, err := driver.Hash("a/invoice.pdf")
+	assert.NoError(t, err)
+	sumB, err := driver.Hash("b/invoice.pdf")
+	assert.NoError(t, err)
+	assert.Equal(t, sumA, sumB)
+
+	// Test Read
+	assert.Equal(t, "attachment", readString(t, driver, "b/invoice.pdf"))
+
+	// Test Write keeps the exists check
+	assert.Equal(t, errors.ErrFileExists, driver.Write("a/invoice.pdf", []byte("x")))
+
+	// Test Delete keeps blobs that are still referenced
+	assert.NoError(t, driver.Delete("a/invoice.pdf"))
+	assert.Equal(t, "attachment", readString(t, driver, "b/invoice.pdf"))
+
+	// Test the last reference removes the blob
+	assert.NoError(t, driver.Delete("b/invoice.pdf"))
+
+	blobs, err = backend.List("blobs/")
+	assert.NoError(t, err)
+	assert.Len(t, blobs, 1)
+
+	_, err = driver.Read("b/invoice.pdf")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+	assert.Equal(t, errors.ErrFileNotFound, driver.Delete("b/invoice.pdf"))
+
+	// Test Update moves the path to a new blob
+	assert.NoError(t, driver.Update("c/other.pdf", []byte(" appended"), false))
+	assert.NoError(t, driver.Update("c/other.pdf", []byte("prepended "), true))
+	assert.Equal(t, "prepended other appended", readString(t, driver, "c/other.pdf"))
+
+	blobs, err = backend.List("blobs/")
+	assert.NoError(t, err)
+	assert.Len(t, blobs, 1)
+
+	paths, err := driver.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c/other.pdf"}, paths)
+}
+
+func TestContentDriverIndex(t *testing.T) {
+	backend := NewMemoryDriver()
+	driver, err := NewContentDriver(backend)
+	assert.NoError(t, err)
+
+	assert.NoError(t, driver.Put("one.txt", []byte("shared")))
+	assert.NoError(t, driver.Put("two.txt", []byte("shared")))
+
+	// Test the index survives a restart
+	reopened, err := NewContentDriver(backend)
+	assert.NoError(t, err)
+	assert.Equal(t, "shared", readString(t, reopened, "one.txt"))
+
+	assert.NoError(t, reopened.Delete("one.txt"))
+	assert.Equal(t, "shared", readString(t, reopened, "two.txt"))
+
+	// Test GC removes orphaned blobs
+	assert.NoError(t, backend.Put("blobs/ff/ffff", []byte("orphan")))
+
+	removed, err := reopened.GC()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+
+	// Test corrupted blobs are detected
+	sum, err := reopened.Hash("two.txt")
+	assert.NoError(t, err)
+	assert.NoError(t, backend.Put(blobPath(sum), []byte("tampered")))
+
+	reader, err := reopened.Read("two.txt")
+	assert.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, errors.ErrCorruptData, err)
+
+	// Test a broken index is refused
+	assert.NoError(t, backend.Put("index.json", []byte("{")))
+	_, err = NewContentDriver(backend)
+	assert.Equal(t, errors.ErrCorruptData, err)
+}
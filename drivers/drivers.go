@@ -1,7 +1,10 @@
 package drivers
 
 import (
+	"github.com/vanvanni/lampofs/errors"
 	"io"
+	"path"
+	"strings"
 )
 
 type Driver interface {
@@ -11,3 +14,56 @@ type Driver interface {
 	Delete(path string) error
 	Update(path string, data []byte, prepend bool) error
 }
+
+// Lister is implemented by drivers that can enumerate their files. List
+// returns every file path starting with prefix, sorted.
+type Lister interface {
+	List(prefix string) ([]string, error)
+}
+
+func listFiles(driver Driver, prefix string) ([]string, error) {
+	lister, ok := driver.(Lister)
+	if !ok {
+		return nil, errors.ErrNotSupported
+	}
+
+	return lister.List(prefix)
+}
+
+// applyUpdate returns existing with data added at the start or the end,
+// as Update does.
+func applyUpdate(existing, data []byte, prepend bool) []byte {
+	if !prepend {
+		return append(existing, data...)
+	}
+
+	newData := make([]byte, len(data)+len(existing))
+	copy(newData, data)
+	copy(newData[len(data):], existing)
+
+	return newData
+}
+
+// cleanPath resolves "." and ".." in a path relative to the driver root
+// and drops the leading slash. Paths that climb above the root fail with
+// ErrPermissionDenied. List prefixes keep their trailing slash.
+func cleanPath(name string) (string, error) {
+	relative := strings.TrimPrefix(name, "/")
+	if relative == "" {
+		return "", nil
+	}
+
+	cleaned := path.Clean(relative)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", errors.ErrPermissionDenied
+	}
+
+	switch {
+	case cleaned == ".":
+		cleaned = ""
+	case strings.HasSuffix(relative, "/"):
+		cleaned += "/"
+	}
+
+	return cleaned, nil
+}
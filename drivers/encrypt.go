@@ -0,0 +1,469 @@
+package drivers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"sync"
+)
+
+const (
+	encryptionMagic     = "LAMPOENC"
+	encryptionVersion   = 1
+	encryptionChunkSize = 64 * 1024
+
+	// maxEncryptionChunkSize bounds the chunk size read from a header,
+	// which is not authenticated, before a buffer of that size is made
+	maxEncryptionChunkSize = 4 * 1024 * 1024
+)
+
+// KeyProvider wraps per-file data keys with a master key.
+type KeyProvider interface {
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// StaticKeyProvider keeps AES-256 master keys in memory. New data keys are
+// wrapped with the current key, older keys stay available for unwrapping
+// until everything has been rewrapped.
+type StaticKeyProvider struct {
+	keys    map[string][]byte
+	current string
+	mutex   sync.RWMutex
+}
+
+func NewStaticKeyProvider(keyID string, masterKey []byte) (*StaticKeyProvider, error) {
+	provider := &StaticKeyProvider{
+		keys: make(map[string][]byte),
+	}
+
+	if err := provider.Rotate(keyID, masterKey); err != nil {
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+// Rotate adds a master key and makes it the current one.
+func (p *StaticKeyProvider) Rotate(keyID string, masterKey []byte) error {
+	if len(masterKey) != 32 {
+		return fmt.Errorf("master key must be 32 bytes, got %d", len(masterKey))
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.keys[keyID] = masterKey
+	p.current = keyID
+
+	return nil
+}
+
+func (p *StaticKeyProvider) WrapKey(dataKey []byte) (string, []byte, error) {
+	p.mutex.RLock()
+	keyID, masterKey := p.current, p.keys[p.current]
+	p.mutex.RUnlock()
+
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+
+	return keyID, aead.Seal(nonce, nonce, dataKey, []byte(keyID)), nil
+}
+
+func (p *StaticKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	p.mutex.RLock()
+	masterKey, exists := p.keys[keyID]
+	p.mutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown master key %q", keyID)
+	}
+
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.ErrCorruptData
+	}
+
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, errors.ErrCorruptData
+	}
+
+	return dataKey, nil
+}
+
+// EncryptDriver encrypts files with AES-256-GCM before they reach the
+// wrapped driver. Every file gets a fresh data key, wrapped by the key
+// provider and stored in the file header. The content is sealed in chunks
+// so Read can decrypt it as a stream.
+//
+// Layout: magic | version | chunk size | key id | wrapped key | chunks
+type EncryptDriver struct {
+	driver    Driver
+	keys      KeyProvider
+	chunkSize int
+}
+
+type encryptionHeader struct {
+	chunkSize int
+	keyID     string
+	wrapped   []byte
+}
+
+func NewEncryptDriver(driver Driver, keys KeyProvider) *EncryptDriver {
+	return &EncryptDriver{
+		driver:    driver,
+		keys:      keys,
+		chunkSize: encryptionChunkSize,
+	}
+}
+
+func (d *EncryptDriver) Read(path string) (io.ReadCloser, error) {
+	reader, err := d.driver.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	buffered := bufio.NewReader(reader)
+
+	header, err := readEncryptionHeader(buffered)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	dataKey, err := d.keys.UnwrapKey(header.keyID, header.wrapped)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	return &decryptReader{
+		source:    buffered,
+		closer:    reader,
+		aead:      aead,
+		chunkSize: header.chunkSize,
+	}, nil
+}
+
+func (d *EncryptDriver) Write(path string, data []byte) error {
+	encrypted, err := d.encrypt(data)
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Write(path, encrypted)
+}
+
+func (d *EncryptDriver) Put(path string, data []byte) error {
+	encrypted, err := d.encrypt(data)
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Put(path, encrypted)
+}
+
+func (d *EncryptDriver) Delete(path string) error {
+	return d.driver.Delete(path)
+}
+
+// Update decrypts the current content, applies the change and stores the
+// result under a fresh data key. Appending ciphertext to the underlying file
+// would break the chunk authentication.
+func (d *EncryptDriver) Update(path string, data []byte, prepend bool) error {
+	reader, err := d.Read(path)
+	if err == errors.ErrFileNotFound {
+		return d.Put(path, data)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	existingData, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	return d.Put(path, applyUpdate(existingData, data, prepend))
+}
+
+func (d *EncryptDriver) List(prefix string) ([]string, error) {
+	return listFiles(d.driver, prefix)
+}
+
+// Rewrap re-encrypts the data key of path with the provider's current
+// master key. The content itself is left untouched.
+func (d *EncryptDriver) Rewrap(path string) error {
+	reader, err := d.driver.Read(path)
+	if err != nil {
+		return err
+	}
+
+	buffered := bufio.NewReader(reader)
+	header, err := readEncryptionHeader(buffered)
+	if err != nil {
+		reader.Close()
+		return err
+	}
+
+	body, err := io.ReadAll(buffered)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	dataKey, err := d.keys.UnwrapKey(header.keyID, header.wrapped)
+	if err != nil {
+		return err
+	}
+
+	header.keyID, header.wrapped, err = d.keys.WrapKey(dataKey)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	writeEncryptionHeader(&buf, header)
+	buf.Write(body)
+
+	return d.driver.Put(path, buf.Bytes())
+}
+
+// RewrapAll rewraps every file under prefix, for use after a key rotation.
+func (d *EncryptDriver) RewrapAll(prefix string) error {
+	paths, err := listFiles(d.driver, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := d.Rewrap(path); err != nil {
+			return fmt.Errorf("rewrap %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+func (d *EncryptDriver) encrypt(data []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	keyID, wrapped, err := d.keys.WrapKey(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeEncryptionHeader(&buf, encryptionHeader{
+		chunkSize: d.chunkSize,
+		keyID:     keyID,
+		wrapped:   wrapped,
+	})
+
+	// Always seal at least one chunk so an empty file still carries the
+	// final marker
+	for index := uint64(0); ; index++ {
+		size := min(d.chunkSize, len(data))
+		final := size == len(data)
+
+		nonce, additional := chunkNonce(aead, index, final)
+		buf.Write(aead.Seal(nil, nonce, data[:size], additional))
+
+		data = data[size:]
+		if final {
+			break
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+type decryptReader struct {
+	source    *bufio.Reader
+	closer    io.Closer
+	aead      cipher.AEAD
+	chunkSize int
+	index     uint64
+	plain     []byte
+	done      bool
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		if err := r.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+
+	return n, nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.closer.Close()
+}
+
+func (r *decryptReader) nextChunk() error {
+	sealed := make([]byte, r.chunkSize+r.aead.Overhead())
+
+	n, err := io.ReadFull(r.source, sealed)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		// A missing final chunk means the file was truncated
+		return truncated(err)
+	}
+
+	final := err == io.ErrUnexpectedEOF
+	if !final {
+		_, err := r.source.Peek(1)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		final = err == io.EOF
+	}
+
+	nonce, additional := chunkNonce(r.aead, r.index, final)
+	plain, err := r.aead.Open(nil, nonce, sealed[:n], additional)
+	if err != nil {
+		return errors.ErrCorruptData
+	}
+
+	r.plain = plain
+	r.index++
+	r.done = final
+
+	return nil
+}
+
+// chunkNonce derives the nonce from the chunk index, which is safe because
+// every file is sealed under its own data key. The final flag is bound in
+// the additional data so truncating at a chunk boundary is detected.
+func chunkNonce(aead cipher.AEAD, index uint64, final bool) ([]byte, []byte) {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], index)
+
+	additional := []byte{0}
+	if final {
+		additional[0] = 1
+	}
+
+	return nonce, additional
+}
+
+func writeEncryptionHeader(buf *bytes.Buffer, header encryptionHeader) {
+	buf.WriteString(encryptionMagic)
+	buf.WriteByte(encryptionVersion)
+	binary.Write(buf, binary.BigEndian, uint32(header.chunkSize))
+	binary.Write(buf, binary.BigEndian, uint16(len(header.keyID)))
+	buf.WriteString(header.keyID)
+	binary.Write(buf, binary.BigEndian, uint16(len(header.wrapped)))
+	buf.Write(header.wrapped)
+}
+
+func readEncryptionHeader(r io.Reader) (encryptionHeader, error) {
+	var header encryptionHeader
+
+	prefix := make([]byte, len(encryptionMagic)+1)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return header, truncated(err)
+	}
+
+	if string(prefix[:len(encryptionMagic)]) != encryptionMagic {
+		return header, errors.ErrCorruptData
+	}
+
+	if prefix[len(encryptionMagic)] != encryptionVersion {
+		return header, errors.ErrCorruptData
+	}
+
+	var chunkSize uint32
+	if err := binary.Read(r, binary.BigEndian, &chunkSize); err != nil {
+		return header, truncated(err)
+	}
+
+	if chunkSize == 0 || chunkSize > maxEncryptionChunkSize {
+		return header, errors.ErrCorruptData
+	}
+	header.chunkSize = int(chunkSize)
+
+	keyID, err := readLengthPrefixed(r)
+	if err != nil {
+		return header, err
+	}
+	header.keyID = string(keyID)
+
+	header.wrapped, err = readLengthPrefixed(r)
+	return header, err
+}
+
+func readLengthPrefixed(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, truncated(err)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, truncated(err)
+	}
+
+	return data, nil
+}
+
+// truncated reports running out of data as ErrCorruptData and passes
+// errors of the wrapped driver through, so they can still be retried.
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.ErrCorruptData
+	}
+
+	return err
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,185 @@
+package drivers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDriver(t *testing.T) {
+	keys, err := NewStaticKeyProvider("v1", bytes.Repeat([]byte{1}, 32))
+	assert.NoError(t, err)
+
+	backend := NewMemoryDriver()
+	driver := NewEncryptDriver(backend, keys)
+	driver.chunkSize = 16
+
+	// Test Write stores ciphertext only
+	testData := []byte("Hello, Encryption! This spans several chunks.")
+	err = driver.Write("test.txt", testData)
+	assert.NoError(t, err)
+
+	raw := readString(t, backend, "test.txt")
+	assert.NotContains(t, raw, "Hello")
+
+	// Test Read decrypts
+	assert.Equal(t, string(testData), readString(t, driver, "test.txt"))
+
+	// Test Write keeps the exists check
+	err = driver.Write("test.txt", testData)
+	assert.Equal(t, errors.ErrFileExists, err)
+
+	// Test Update (append and prepend)
+	err = driver.Update("test.txt", []byte(" Appended"), false)
+	assert.NoError(t, err)
+	err = driver.Update("test.txt", []byte("Prepended "), true)
+	assert.NoError(t, err)
+	assert.Equal(t, "Prepended "+string(testData)+" Appended", readString(t, driver, "test.txt"))
+
+	// Test Update on a missing file creates it
+	err = driver.Update("new.txt", []byte("new"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", readString(t, driver, "new.txt"))
+
+	// Test empty files and exact chunk multiples
+	assert.NoError(t, driver.Put("empty.txt", []byte{}))
+	assert.Equal(t, "", readString(t, driver, "empty.txt"))
+
+	assert.NoError(t, driver.Put("exact.txt", bytes.Repeat([]byte("x"), 32)))
+	assert.Equal(t, string(bytes.Repeat([]byte("x"), 32)), readString(t, driver, "exact.txt"))
+
+	// Test Delete
+	err = driver.Delete("test.txt")
+	assert.NoError(t, err)
+
+	_, err = driver.Read("test.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+}
+
+func TestEncryptDriverTampering(t *testing.T) {
+	keys, err := NewStaticKeyProvider("v1", bytes.Repeat([]byte{1}, 32))
+	assert.NoError(t, err)
+
+	backend := NewMemoryDriver()
+	driver := NewEncryptDriver(backend, keys)
+	driver.chunkSize = 16
+
+	assert.NoError(t, driver.Put("test.txt", bytes.Repeat([]byte("a"), 40)))
+	raw := []byte(readString(t, backend, "test.txt"))
+
+	// Test flipped bits are detected
+	tampered := append([]byte{}, raw...)
+	tampered[len(tampered)-1] ^= 1
+	assert.NoError(t, backend.Put("test.txt", tampered))
+
+	reader, err := driver.Read("test.txt")
+	assert.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	assert.Equal(t, errors.ErrCorruptData, err)
+
+	// Test truncation at a chunk boundary is detected
+	assert.NoError(t, backend.Put("test.txt", raw[:len(raw)-(8+16)]))
+
+	reader, err = driver.Read("test.txt")
+	assert.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	assert.Equal(t, errors.ErrCorruptData, err)
+
+	// Test files that were never encrypted
+	assert.NoError(t, backend.Put("plain.txt", []byte("plain text")))
+	_, err = driver.Read("plain.txt")
+	assert.Equal(t, errors.ErrCorruptData, err)
+
+	// Test oversized chunks in the header are refused before allocating
+	oversized := append([]byte{}, raw...)
+	binary.BigEndian.PutUint32(oversized[len(encryptionMagic)+1:], 1<<31)
+	assert.NoError(t, backend.Put("test.txt", oversized))
+
+	_, err = driver.Read("test.txt")
+	assert.Equal(t, errors.ErrCorruptData, err)
+
+	// Test the wrong master key is refused
+	other, err := NewStaticKeyProvider("v1", bytes.Repeat([]byte{2}, 32))
+	assert.NoError(t, err)
+	assert.NoError(t, driver.Put("test.txt", []byte("secret")))
+
+	_, err = NewEncryptDriver(backend, other).Read("test.txt")
+	assert.Equal(t, errors.ErrCorruptData, err)
+
+	// Test master keys must be AES-256
+	_, err = NewStaticKeyProvider("short", []byte("too short"))
+	assert.Error(t, err)
+}
+
+func TestEncryptDriverRotation(t *testing.T) {
+	keys, err := NewStaticKeyProvider("v1", bytes.Repeat([]byte{1}, 32))
+	assert.NoError(t, err)
+
+	backend := NewMemoryDriver()
+	driver := NewEncryptDriver(backend, keys)
+
+	assert.NoError(t, driver.Put("a.txt", []byte("first")))
+	assert.NoError(t, driver.Put("b.txt", []byte("second")))
+
+	// Rotate and rewrap everything under the new key
+	assert.NoError(t, keys.Rotate("v2", bytes.Repeat([]byte{2}, 32)))
+	assert.NoError(t, driver.RewrapAll(""))
+
+	// Only the new key is needed afterwards
+	rotated, err := NewStaticKeyProvider("v2", bytes.Repeat([]byte{2}, 32))
+	assert.NoError(t, err)
+
+	reader := NewEncryptDriver(backend, rotated)
+	assert.Equal(t, "first", readString(t, reader, "a.txt"))
+	assert.Equal(t, "second", readString(t, reader, "b.txt"))
+}
+
+// brokenReadDriver returns readers that fail with errUnavailable after
+// limit bytes.
+type brokenReadDriver struct {
+	Driver
+	limit int64
+}
+
+func (d *brokenReadDriver) Read(path string) (io.ReadCloser, error) {
+	reader, err := d.Driver.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &limitedReadCloser{
+		Reader: io.MultiReader(io.LimitReader(reader, d.limit), iotest.ErrReader(errUnavailable)),
+		Closer: reader,
+	}, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func TestEncryptDriverReadErrors(t *testing.T) {
+	keys, err := NewStaticKeyProvider("v1", bytes.Repeat([]byte{1}, 32))
+	assert.NoError(t, err)
+
+	backend := &brokenReadDriver{Driver: NewMemoryDriver()}
+	driver := NewEncryptDriver(backend, keys)
+	driver.chunkSize = 16
+	assert.NoError(t, driver.Put("test.txt", bytes.Repeat([]byte("a"), 40)))
+
+	// Test failures of the wrapped driver are not reported as tampering
+	backend.limit = 4
+	_, err = driver.Read("test.txt")
+	assert.Equal(t, errUnavailable, err)
+
+	backend.limit = 100
+	reader, err := driver.Read("test.txt")
+	assert.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	assert.Equal(t, errUnavailable, err)
+}
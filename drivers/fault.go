@@ -0,0 +1,233 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"math/rand"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+type FaultKind int
+
+const (
+	FaultError        FaultKind = iota // fail with Err without calling the driver
+	FaultTimeout                       // wait Latency, then fail with context.DeadlineExceeded
+	FaultPartialWrite                  // store the first half of the data, then fail
+	FaultCorruptRead                   // flip a byte of what is read
+	FaultLatency                       // wait Latency, then carry on
+)
+
+type Fault struct {
+	Kind        FaultKind
+	Operations  []string      // READ, WRITE, PUT, DELETE or UPDATE, empty for all
+	Pattern     string        // path.Match pattern, "" for every path
+	Probability float64       // chance a matching call is hit, 0 for always
+	After       int           // matching calls to let through first
+	Times       int           // how often the fault fires, 0 for no limit
+	Err         error         // for FaultError, defaults to ErrPermissionDenied
+	Latency     time.Duration // for FaultTimeout and FaultLatency
+}
+
+type FaultOptions struct {
+	Faults []Fault
+	Seed   int64 // the same seed injects the same faults for the same calls
+}
+
+// FaultDriver injects failures into calls to the wrapped driver, for
+// testing how callers deal with storage that misbehaves. Faults are
+// checked in order; latency faults add up, and the first other fault that
+// fires decides the outcome.
+type FaultDriver struct {
+	driver Driver
+	faults []*faultState
+	random *rand.Rand
+	sleep  func(time.Duration)
+	mutex  sync.Mutex
+}
+
+type faultState struct {
+	Fault
+	seen  int
+	fired int
+}
+
+func NewFaultDriver(driver Driver, opts FaultOptions) *FaultDriver {
+	d := &FaultDriver{
+		driver: driver,
+		random: rand.New(rand.NewSource(opts.Seed)),
+		sleep:  time.Sleep,
+	}
+
+	for _, fault := range opts.Faults {
+		if fault.Kind == FaultError && fault.Err == nil {
+			fault.Err = errors.ErrPermissionDenied
+		}
+		d.faults = append(d.faults, &faultState{Fault: fault})
+	}
+
+	return d
+}
+
+func (d *FaultDriver) Read(path string) (io.ReadCloser, error) {
+	fault, err := d.inject("READ", path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := d.driver.Read(path)
+	if err != nil || fault != FaultCorruptRead {
+		return reader, err
+	}
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > 0 {
+		d.mutex.Lock()
+		data[d.random.Intn(len(data))] ^= 0xff
+		d.mutex.Unlock()
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (d *FaultDriver) Write(path string, data []byte) error {
+	return d.change("WRITE", path, data, func(data []byte) error {
+		return d.driver.Write(path, data)
+	})
+}
+
+func (d *FaultDriver) Put(path string, data []byte) error {
+	return d.change("PUT", path, data, func(data []byte) error {
+		return d.driver.Put(path, data)
+	})
+}
+
+func (d *FaultDriver) Delete(path string) error {
+	if _, err := d.inject("DELETE", path); err != nil {
+		return err
+	}
+
+	return d.driver.Delete(path)
+}
+
+func (d *FaultDriver) Update(path string, data []byte, prepend bool) error {
+	return d.change("UPDATE", path, data, func(data []byte) error {
+		return d.driver.Update(path, data, prepend)
+	})
+}
+
+func (d *FaultDriver) List(prefix string) ([]string, error) {
+	if _, err := d.inject("READ", prefix); err != nil {
+		return nil, err
+	}
+
+	return listFiles(d.driver, prefix)
+}
+
+func (d *FaultDriver) change(operation, path string, data []byte, apply func(data []byte) error) error {
+	fault, err := d.inject(operation, path)
+	if err != nil {
+		return err
+	}
+
+	if fault != FaultPartialWrite {
+		return apply(data)
+	}
+
+	if err := apply(data[:len(data)/2]); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("injected partial write of %s: %w", path, io.ErrShortWrite)
+}
+
+// faultNone is returned by inject when no fault fired.
+const faultNone FaultKind = -1
+
+// inject applies latency and returns the fault that fired, if any. Error
+// and timeout faults come back as the error to return.
+func (d *FaultDriver) inject(operation, name string) (FaultKind, error) {
+	d.mutex.Lock()
+
+	var (
+		delay time.Duration
+		fired *faultState
+	)
+
+	for _, fault := range d.faults {
+		if fired != nil && fault.Kind != FaultLatency {
+			continue
+		}
+
+		if !d.fires(fault, operation, name) {
+			continue
+		}
+
+		if fault.Kind == FaultLatency {
+			delay += fault.Latency
+			continue
+		}
+
+		fired = fault
+		if fault.Kind == FaultTimeout {
+			delay += fault.Latency
+		}
+	}
+
+	d.mutex.Unlock()
+
+	if delay > 0 {
+		d.sleep(delay)
+	}
+
+	if fired == nil {
+		return faultNone, nil
+	}
+
+	switch fired.Kind {
+	case FaultError:
+		return fired.Kind, fired.Err
+	case FaultTimeout:
+		return fired.Kind, fmt.Errorf("injected timeout on %s %s: %w", operation, name, context.DeadlineExceeded)
+	}
+
+	return fired.Kind, nil
+}
+
+func (d *FaultDriver) fires(fault *faultState, operation, name string) bool {
+	if len(fault.Operations) > 0 && !slices.Contains(fault.Operations, operation) {
+		return false
+	}
+
+	if fault.Pattern != "" {
+		if matched, _ := path.Match(fault.Pattern, name); !matched {
+			return false
+		}
+	}
+
+	fault.seen++
+	if fault.seen <= fault.After {
+		return false
+	}
+
+	if fault.Times > 0 && fault.fired >= fault.Times {
+		return false
+	}
+
+	if fault.Probability > 0 && d.random.Float64() >= fault.Probability {
+		return false
+	}
+
+	fault.fired++
+	return true
+}
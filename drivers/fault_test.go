@@ -0,0 +1,104 @@
+package drivers
+
+import (
+	"context"
+	goerrors "errors"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFaultDriver(driver Driver, opts FaultOptions) (*FaultDriver, *time.Duration) {
+	slept := new(time.Duration)
+
+	faults := NewFaultDriver(driver, opts)
+	faults.sleep = func(delay time.Duration) { *slept += delay }
+
+	return faults, slept
+}
+
+func TestFaultDriverError(t *testing.T) {
+	faults, _ := newTestFaultDriver(NewMemoryDriver(), FaultOptions{
+		Faults: []Fault{{Kind: FaultError, Operations: []string{"PUT"}, Pattern: "private/*"}},
+	})
+
+	assert.Equal(t, errors.ErrPermissionDenied, faults.Put("private/a.txt", []byte("a")))
+	assert.NoError(t, faults.Put("public/a.txt", []byte("a")))
+	assert.NoError(t, faults.Write("private/b.txt", []byte("b")))
+}
+
+func TestFaultDriverOperationCount(t *testing.T) {
+	faults, _ := newTestFaultDriver(NewMemoryDriver(), FaultOptions{
+		Faults: []Fault{{Kind: FaultError, After: 2, Times: 1, Err: errUnavailable}},
+	})
+
+	assert.NoError(t, faults.Put("a.txt", []byte("1")))
+	assert.NoError(t, faults.Put("a.txt", []byte("2")))
+	assert.Equal(t, errUnavailable, faults.Put("a.txt", []byte("3")))
+	assert.NoError(t, faults.Put("a.txt", []byte("4")))
+}
+
+func TestFaultDriverTimeoutAndLatency(t *testing.T) {
+	faults, slept := newTestFaultDriver(NewMemoryDriver(), FaultOptions{
+		Faults: []Fault{
+			{Kind: FaultLatency, Latency: 100 * time.Millisecond},
+			{Kind: FaultTimeout, Operations: []string{"DELETE"}, Latency: time.Second},
+		},
+	})
+
+	assert.NoError(t, faults.Put("a.txt", []byte("a")))
+	assert.Equal(t, 100*time.Millisecond, *slept)
+
+	err := faults.Delete("a.txt")
+	assert.True(t, goerrors.Is(err, context.DeadlineExceeded))
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, 1200*time.Millisecond, *slept)
+}
+
+func TestFaultDriverPartialWrite(t *testing.T) {
+	memory := NewMemoryDriver()
+	faults, _ := newTestFaultDriver(memory, FaultOptions{
+		Faults: []Fault{{Kind: FaultPartialWrite, Times: 1}},
+	})
+
+	err := faults.Put("a.txt", []byte("abcdef"))
+	assert.True(t, goerrors.Is(err, io.ErrShortWrite))
+	assert.Equal(t, "abc", readString(t, memory, "a.txt"))
+}
+
+func TestFaultDriverCorruptRead(t *testing.T) {
+	memory := NewMemoryDriver()
+	memory.Put("a.txt", []byte("hello"))
+
+	faults, _ := newTestFaultDriver(memory, FaultOptions{
+		Faults: []Fault{{Kind: FaultCorruptRead}},
+	})
+
+	corrupted := readString(t, faults, "a.txt")
+	assert.Len(t, corrupted, 5)
+	assert.NotEqual(t, "hello", corrupted)
+	assert.Equal(t, "hello", readString(t, memory, "a.txt"))
+}
+
+func TestFaultDriverSeed(t *testing.T) {
+	run := func(seed int64) []bool {
+		faults, _ := newTestFaultDriver(NewMemoryDriver(), FaultOptions{
+			Faults: []Fault{{Kind: FaultError, Probability: 0.5}},
+			Seed:   seed,
+		})
+
+		failed := make([]bool, 20)
+		for i := range failed {
+			failed[i] = faults.Put("a.txt", []byte("a")) != nil
+		}
+		return failed
+	}
+
+	first := run(42)
+	assert.Equal(t, first, run(42))
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+}
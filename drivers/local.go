@@ -3,8 +3,10 @@ package drivers
 import (
 	"github.com/vanvanni/lampofs/errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type LocalDriver struct {
@@ -101,6 +103,35 @@ func (d *LocalDriver) Update(path string, data []byte, prepend bool) error {
 	return d.appendToFile(fullPath, data)
 }
 
+func (d *LocalDriver) List(prefix string) ([]string, error) {
+	prefix = strings.TrimPrefix(prefix, "/")
+	paths := make([]string, 0)
+
+	err := filepath.WalkDir(d.rootPath, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(d.rootPath, fullPath)
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+		if strings.HasPrefix(rel, prefix) {
+			paths = append(paths, rel)
+		}
+
+		return nil
+	})
+
+	return paths, err
+}
+
 func (d *LocalDriver) appendToFile(path string, data []byte) error {
 	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
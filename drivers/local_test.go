@@ -117,3 +117,21 @@ func TestLocalDriverErrors(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, errors.ErrFileNotFound, err)
 }
+
+func TestLocalDriverList(t *testing.T) {
+	driver, err := NewLocalDriver(t.TempDir())
+	assert.NoError(t, err)
+
+	for _, path := range []string{"b/2.txt", "a/1.txt", "b/1.txt", "c.txt"} {
+		err := driver.Write(path, []byte("test"))
+		assert.NoError(t, err)
+	}
+
+	paths, err := driver.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/1.txt", "b/1.txt", "b/2.txt", "c.txt"}, paths)
+
+	paths, err = driver.List("/b/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b/1.txt", "b/2.txt"}, paths)
+}
@@ -0,0 +1,159 @@
+package drivers
+
+import (
+	"context"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"log/slog"
+	"path"
+	"time"
+)
+
+type LoggingOptions struct {
+	Logger     *slog.Logger // nil uses slog.Default()
+	Level      slog.Leveler // successful operations, nil for slog.LevelDebug
+	ErrorLevel slog.Leveler // failed operations, nil for slog.LevelError
+	// Redact rewrites paths before they are logged, for filenames that
+	// should not end up in logs. See RedactMatching.
+	Redact func(path string) string
+}
+
+// LoggingDriver logs every operation with its path, size, duration and
+// error. Missing files are logged at Level, since reads of files that may
+// not exist are usually expected.
+type LoggingDriver struct {
+	driver Driver
+	opts   LoggingOptions
+}
+
+func NewLoggingDriver(driver Driver, opts LoggingOptions) *LoggingDriver {
+	return &LoggingDriver{
+		driver: driver,
+		opts:   opts.withDefaults(),
+	}
+}
+
+func (d *LoggingDriver) Read(path string) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := d.driver.Read(path)
+	d.log("READ", path, -1, start, err)
+
+	return reader, err
+}
+
+func (d *LoggingDriver) Write(path string, data []byte) error {
+	start := time.Now()
+	err := d.driver.Write(path, data)
+	d.log("WRITE", path, len(data), start, err)
+
+	return err
+}
+
+func (d *LoggingDriver) Put(path string, data []byte) error {
+	start := time.Now()
+	err := d.driver.Put(path, data)
+	d.log("PUT", path, len(data), start, err)
+
+	return err
+}
+
+func (d *LoggingDriver) Delete(path string) error {
+	start := time.Now()
+	err := d.driver.Delete(path)
+	d.log("DELETE", path, -1, start, err)
+
+	return err
+}
+
+func (d *LoggingDriver) Update(path string, data []byte, prepend bool) error {
+	operation := "APPEND"
+	if prepend {
+		operation = "PREPEND"
+	}
+
+	start := time.Now()
+	err := d.driver.Update(path, data, prepend)
+	d.log(operation, path, len(data), start, err)
+
+	return err
+}
+
+func (d *LoggingDriver) List(prefix string) ([]string, error) {
+	start := time.Now()
+	paths, err := listFiles(d.driver, prefix)
+	d.log("LIST", prefix, -1, start, err)
+
+	return paths, err
+}
+
+func (d *LoggingDriver) log(operation, path string, size int, start time.Time, err error) {
+	d.opts.LogOperation(operation, path, size, time.Since(start), err)
+}
+
+// LogOperation logs one operation the way LoggingDriver does. operation is
+// READ, WRITE, PUT, DELETE, APPEND, PREPEND or LIST, size is -1 when the
+// operation carries no data.
+func (opts LoggingOptions) LogOperation(operation, path string, size int, duration time.Duration, err error) {
+	opts = opts.withDefaults()
+
+	level := opts.Level.Level()
+	if err != nil && err != errors.ErrFileNotFound {
+		level = opts.ErrorLevel.Level()
+	}
+
+	if !opts.Logger.Enabled(context.Background(), level) {
+		return
+	}
+
+	if opts.Redact != nil {
+		path = opts.Redact(path)
+	}
+
+	attrs := []slog.Attr{
+		slog.String("operation", operation),
+		slog.String("path", path),
+		slog.Duration("duration", duration),
+	}
+	if size >= 0 {
+		attrs = append(attrs, slog.Int("size", size))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	opts.Logger.LogAttrs(context.Background(), level, "lampofs "+operation, attrs...)
+}
+
+func (opts LoggingOptions) withDefaults() LoggingOptions {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	if opts.Level == nil {
+		opts.Level = slog.LevelDebug
+	}
+
+	if opts.ErrorLevel == nil {
+		opts.ErrorLevel = slog.LevelError
+	}
+
+	return opts
+}
+
+// RedactMatching returns a Redact hook that hides paths whose full path or
+// base name matches one of the path.Match patterns.
+func RedactMatching(patterns ...string) func(string) string {
+	return func(name string) string {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, name); matched {
+				return "[redacted]"
+			}
+
+			if matched, _ := path.Match(pattern, path.Base(name)); matched {
+				return "[redacted]"
+			}
+		}
+
+		return name
+	}
+}
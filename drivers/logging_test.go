@@ -0,0 +1,69 @@
+package drivers
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+			if attr.Key == slog.TimeKey || attr.Key == "duration" {
+				return slog.Attr{}
+			}
+			return attr
+		},
+	}))
+}
+
+func TestLoggingDriver(t *testing.T) {
+	var buf bytes.Buffer
+	driver := NewLoggingDriver(NewMemoryDriver(), LoggingOptions{Logger: newTestLogger(&buf)})
+
+	driver.Write("a.txt", []byte("hello"))
+	driver.Write("a.txt", []byte("hello"))
+	driver.Read("missing.txt")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, []string{
+		`level=DEBUG msg="lampofs WRITE" operation=WRITE path=a.txt size=5`,
+		`level=ERROR msg="lampofs WRITE" operation=WRITE path=a.txt size=5 error="file already exists"`,
+		`level=DEBUG msg="lampofs READ" operation=READ path=missing.txt error="file not found"`,
+	}, lines)
+}
+
+func TestLoggingDriverLevels(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	driver := NewLoggingDriver(NewMemoryDriver(), LoggingOptions{Logger: logger})
+
+	// Successful operations log at debug by default
+	driver.Put("a.txt", []byte("a"))
+	assert.Empty(t, buf.String())
+
+	driver = NewLoggingDriver(NewMemoryDriver(), LoggingOptions{Logger: logger, Level: slog.LevelInfo})
+	driver.Put("a.txt", []byte("a"))
+	assert.Contains(t, buf.String(), "level=INFO")
+}
+
+func TestLoggingDriverRedact(t *testing.T) {
+	var buf bytes.Buffer
+	driver := NewLoggingDriver(NewMemoryDriver(), LoggingOptions{
+		Logger: newTestLogger(&buf),
+		Redact: RedactMatching("*.key", "secrets/*"),
+	})
+
+	driver.Put("certs/server.key", []byte("k"))
+	driver.Put("secrets/token", []byte("t"))
+	driver.Put("public/index.html", []byte("i"))
+
+	assert.NotContains(t, buf.String(), "server.key")
+	assert.NotContains(t, buf.String(), "token")
+	assert.Equal(t, 2, strings.Count(buf.String(), "path=[redacted]"))
+	assert.Contains(t, buf.String(), "path=public/index.html")
+}
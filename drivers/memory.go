@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"github.com/vanvanni/lampofs/errors"
 	"io"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -105,15 +107,22 @@ func (d *MemoryDriver) Update(path string, data []byte, prepend bool) error {
 		return nil
 	}
 
-	if prepend {
-		newData := make([]byte, len(data)+len(file.data))
-		copy(newData, data)
-		copy(newData[len(data):], file.data)
-		file.data = newData
-	} else {
-		file.data = append(file.data, data...)
-	}
-
+	file.data = applyUpdate(file.data, data, prepend)
 	file.updatedAt = time.Now()
 	return nil
 }
+
+func (d *MemoryDriver) List(prefix string) ([]string, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	paths := make([]string, 0)
+	for path := range d.files {
+		if strings.HasPrefix(path, prefix) {
+			paths = append(paths, path)
+		}
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
@@ -1,6 +1,7 @@
 package drivers
 
 import (
+	"github.com/vanvanni/lampofs/errors"
 	"io"
 	"testing"
 
@@ -79,7 +80,7 @@ func TestMemoryDriver(t *testing.T) {
 	// Verify file is deleted
 	_, err = driver.Read("test.txt")
 	assert.Error(t, err)
-	assert.Equal(t, ErrFileNotFound, err)
+	assert.Equal(t, errors.ErrFileNotFound, err)
 }
 
 func TestMemoryDriverErrors(t *testing.T) {
@@ -89,7 +90,7 @@ func TestMemoryDriverErrors(t *testing.T) {
 	// Test reading non-existent file
 	_, err := driver.Read("nonexistent.txt")
 	assert.Error(t, err)
-	assert.Equal(t, ErrFileNotFound, err)
+	assert.Equal(t, errors.ErrFileNotFound, err)
 
 	// Test writing to existing file (should fail)
 	testData := []byte("test")
@@ -98,10 +99,27 @@ func TestMemoryDriverErrors(t *testing.T) {
 
 	err = driver.Write("existing.txt", testData)
 	assert.Error(t, err)
-	assert.Equal(t, ErrFileExists, err)
+	assert.Equal(t, errors.ErrFileExists, err)
 
 	// Test deleting non-existent file
 	err = driver.Delete("nonexistent.txt")
 	assert.Error(t, err)
-	assert.Equal(t, ErrFileNotFound, err)
+	assert.Equal(t, errors.ErrFileNotFound, err)
+}
+
+func TestMemoryDriverList(t *testing.T) {
+	driver := NewMemoryDriver()
+
+	for _, path := range []string{"b/2.txt", "a/1.txt", "b/1.txt", "c.txt"} {
+		err := driver.Write(path, []byte("test"))
+		assert.NoError(t, err)
+	}
+
+	paths, err := driver.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/1.txt", "b/1.txt", "b/2.txt", "c.txt"}, paths)
+
+	paths, err = driver.List("b/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b/1.txt", "b/2.txt"}, paths)
 }
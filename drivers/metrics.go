@@ -0,0 +1,177 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the collectors shared by MetricsDrivers. It has its own
+// registry served by Handler, and is a prometheus.Collector itself so it
+// can be registered elsewhere too.
+type Metrics struct {
+	registry   *prometheus.Registry
+	operations *prometheus.CounterVec
+	duration   *prometheus.HistogramVec
+	bytes      *prometheus.CounterVec
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "lampofs",
+			Name:      "operations_total",
+			Help:      "Storage operations by driver, operation and result.",
+		}, []string{"driver", "operation", "result"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "lampofs",
+			Name:      "operation_duration_seconds",
+			Help:      "Storage operation latency by driver and operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"driver", "operation"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "lampofs",
+			Name:      "bytes_total",
+			Help:      "Bytes transferred by driver and direction.",
+		}, []string{"driver", "direction"}),
+	}
+
+	m.registry.MustRegister(m)
+	return m
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.operations.Describe(ch)
+	m.duration.Describe(ch)
+	m.bytes.Describe(ch)
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.operations.Collect(ch)
+	m.duration.Collect(ch)
+	m.bytes.Collect(ch)
+}
+
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the registry in the Prometheus exposition format, ready
+// to be mounted at /metrics.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// MetricsDriver records every operation on the wrapped driver under the
+// given driver name.
+type MetricsDriver struct {
+	driver  Driver
+	metrics *Metrics
+	name    string
+}
+
+func NewMetricsDriver(driver Driver, metrics *Metrics, name string) *MetricsDriver {
+	return &MetricsDriver{
+		driver:  driver,
+		metrics: metrics,
+		name:    name,
+	}
+}
+
+func (d *MetricsDriver) Read(path string) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := d.driver.Read(path)
+	d.observe("read", start, err)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &metricsReader{
+		ReadCloser: reader,
+		bytes:      d.metrics.bytes.WithLabelValues(d.name, "read"),
+	}, nil
+}
+
+func (d *MetricsDriver) Write(path string, data []byte) error {
+	start := time.Now()
+	err := d.driver.Write(path, data)
+	d.observe("write", start, err)
+	d.written(len(data), err)
+
+	return err
+}
+
+func (d *MetricsDriver) Put(path string, data []byte) error {
+	start := time.Now()
+	err := d.driver.Put(path, data)
+	d.observe("put", start, err)
+	d.written(len(data), err)
+
+	return err
+}
+
+func (d *MetricsDriver) Delete(path string) error {
+	start := time.Now()
+	err := d.driver.Delete(path)
+	d.observe("delete", start, err)
+
+	return err
+}
+
+func (d *MetricsDriver) Update(path string, data []byte, prepend bool) error {
+	start := time.Now()
+	err := d.driver.Update(path, data, prepend)
+	d.observe("update", start, err)
+	d.written(len(data), err)
+
+	return err
+}
+
+func (d *MetricsDriver) List(prefix string) ([]string, error) {
+	start := time.Now()
+	paths, err := listFiles(d.driver, prefix)
+	d.observe("list", start, err)
+
+	return paths, err
+}
+
+func (d *MetricsDriver) observe(operation string, start time.Time, err error) {
+	d.metrics.duration.WithLabelValues(d.name, operation).Observe(time.Since(start).Seconds())
+	d.metrics.operations.WithLabelValues(d.name, operation, metricsResult(err)).Inc()
+}
+
+func (d *MetricsDriver) written(n int, err error) {
+	if err == nil {
+		d.metrics.bytes.WithLabelValues(d.name, "written").Add(float64(n))
+	}
+}
+
+// metricsResult keeps missing files apart from real failures, since reads
+// of missing files are usually expected.
+func metricsResult(err error) string {
+	switch err {
+	case nil:
+		return "ok"
+	case errors.ErrFileNotFound:
+		return "not_found"
+	}
+
+	return "error"
+}
+
+type metricsReader struct {
+	io.ReadCloser
+	bytes prometheus.Counter
+}
+
+func (r *metricsReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.bytes.Add(float64(n))
+	return n, err
+}
@@ -0,0 +1,56 @@
+package drivers
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsDriverCountsOperations(t *testing.T) {
+	metrics := NewMetrics()
+	driver := NewMetricsDriver(NewMemoryDriver(), metrics, "memory")
+
+	driver.Write("a.txt", []byte("hello"))
+	driver.Write("a.txt", []byte("hello"))
+	driver.Read("missing.txt")
+	assert.Equal(t, "hello", readString(t, driver, "a.txt"))
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.operations.WithLabelValues("memory", "write", "ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.operations.WithLabelValues("memory", "write", "error")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.operations.WithLabelValues("memory", "read", "not_found")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.operations.WithLabelValues("memory", "read", "ok")))
+
+	assert.Equal(t, 5.0, testutil.ToFloat64(metrics.bytes.WithLabelValues("memory", "written")))
+	assert.Equal(t, 5.0, testutil.ToFloat64(metrics.bytes.WithLabelValues("memory", "read")))
+}
+
+func TestMetricsDriverSharedMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	primary := NewMetricsDriver(NewMemoryDriver(), metrics, "primary")
+	backup := NewMetricsDriver(NewMemoryDriver(), metrics, "backup")
+
+	primary.Put("a.txt", []byte("a"))
+	backup.Put("a.txt", []byte("a"))
+	backup.Delete("a.txt")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.operations.WithLabelValues("primary", "put", "ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.operations.WithLabelValues("backup", "put", "ok")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.operations.WithLabelValues("backup", "delete", "ok")))
+}
+
+func TestMetricsHandler(t *testing.T) {
+	metrics := NewMetrics()
+	driver := NewMetricsDriver(NewMemoryDriver(), metrics, "memory")
+	driver.Put("a.txt", []byte("a"))
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, _ := io.ReadAll(recorder.Body)
+	assert.Contains(t, string(body), `lampofs_operations_total{driver="memory",operation="put",result="ok"} 1`)
+	assert.Contains(t, string(body), `lampofs_operation_duration_seconds_count{driver="memory",operation="put"} 1`)
+	assert.Contains(t, string(body), `lampofs_bytes_total{direction="written",driver="memory"} 1`)
+}
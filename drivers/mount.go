@@ -0,0 +1,231 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MountDriver routes each path to the driver mounted at its longest matching
+// prefix. The prefix is stripped before the call reaches that driver.
+type MountDriver struct {
+	mounts []mountPoint
+	mutex  sync.RWMutex
+}
+
+type mountPoint struct {
+	prefix string
+	driver Driver
+}
+
+func NewMountDriver() *MountDriver {
+	return &MountDriver{
+		mounts: make([]mountPoint, 0),
+	}
+}
+
+// Mount attaches driver at prefix, replacing any driver already mounted
+// there. An empty prefix (or "/") mounts the fallback for unmatched paths.
+func (d *MountDriver) Mount(prefix string, driver Driver) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	prefix = strings.Trim(prefix, "/")
+
+	for i, mount := range d.mounts {
+		if mount.prefix == prefix {
+			d.mounts[i].driver = driver
+			return
+		}
+	}
+
+	d.mounts = append(d.mounts, mountPoint{prefix: prefix, driver: driver})
+
+	// Longest prefix first so resolve can stop at the first match
+	sort.SliceStable(d.mounts, func(i, j int) bool {
+		return len(d.mounts[i].prefix) > len(d.mounts[j].prefix)
+	})
+}
+
+func (d *MountDriver) Unmount(prefix string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	prefix = strings.Trim(prefix, "/")
+
+	for i, mount := range d.mounts {
+		if mount.prefix == prefix {
+			d.mounts = append(d.mounts[:i], d.mounts[i+1:]...)
+			return
+		}
+	}
+}
+
+func (d *MountDriver) Read(path string) (io.ReadCloser, error) {
+	mount, inner, err := d.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return mount.driver.Read(inner)
+}
+
+func (d *MountDriver) Write(path string, data []byte) error {
+	mount, inner, err := d.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	return mount.driver.Write(inner, data)
+}
+
+func (d *MountDriver) Put(path string, data []byte) error {
+	mount, inner, err := d.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	return mount.driver.Put(inner, data)
+}
+
+func (d *MountDriver) Delete(path string) error {
+	mount, inner, err := d.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	return mount.driver.Delete(inner)
+}
+
+func (d *MountDriver) Update(path string, data []byte, prepend bool) error {
+	mount, inner, err := d.resolve(path)
+	if err != nil {
+		return err
+	}
+
+	return mount.driver.Update(inner, data, prepend)
+}
+
+// Copy reads src into memory and puts it at dst, overwriting dst. Both
+// paths may live on different mounts.
+func (d *MountDriver) Copy(src, dst string) error {
+	reader, err := d.Read(src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	return d.Put(dst, data)
+}
+
+// Move copies src to dst and deletes src. Moving a file onto itself only
+// checks that it exists.
+func (d *MountDriver) Move(src, dst string) error {
+	from, fromInner, err := d.resolve(src)
+	if err != nil {
+		return err
+	}
+
+	to, toInner, err := d.resolve(dst)
+	if err != nil {
+		return err
+	}
+
+	if from.prefix == to.prefix && fromInner == toInner {
+		reader, err := d.Read(src)
+		if err != nil {
+			return err
+		}
+
+		return reader.Close()
+	}
+
+	if err := d.Copy(src, dst); err != nil {
+		return err
+	}
+
+	return d.Delete(src)
+}
+
+// List merges the listings of every mount that can hold paths starting with
+// prefix. Files in a parent mount that are shadowed by a nested mount are
+// left out.
+func (d *MountDriver) List(prefix string) ([]string, error) {
+	d.mutex.RLock()
+	mounts := make([]mountPoint, len(d.mounts))
+	copy(mounts, d.mounts)
+	d.mutex.RUnlock()
+
+	prefix = strings.TrimPrefix(prefix, "/")
+	seen := make(map[string]bool)
+	paths := make([]string, 0)
+
+	for _, mount := range mounts {
+		var inner string
+
+		switch {
+		case mount.prefix == "":
+			inner = prefix
+		case strings.HasPrefix(mount.prefix, prefix):
+			inner = ""
+		case strings.HasPrefix(prefix, mount.prefix+"/"):
+			inner = prefix[len(mount.prefix)+1:]
+		default:
+			continue
+		}
+
+		files, err := listFiles(mount.driver, inner)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			path := strings.TrimPrefix(file, "/")
+			if mount.prefix != "" {
+				path = mount.prefix + "/" + path
+			}
+
+			if owner, _, err := d.match(mounts, path); err != nil || owner.prefix != mount.prefix {
+				continue
+			}
+
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (d *MountDriver) resolve(path string) (mountPoint, string, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	return d.match(d.mounts, path)
+}
+
+func (d *MountDriver) match(mounts []mountPoint, path string) (mountPoint, string, error) {
+	path = strings.TrimPrefix(path, "/")
+
+	for _, mount := range mounts {
+		if mount.prefix == "" {
+			return mount, path, nil
+		}
+
+		if path == mount.prefix || strings.HasPrefix(path, mount.prefix+"/") {
+			return mount, strings.TrimPrefix(path[len(mount.prefix):], "/"), nil
+		}
+	}
+
+	return mountPoint{}, "", errors.ErrNotMounted
+}
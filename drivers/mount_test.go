@@ -0,0 +1,130 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMountDriver(t *testing.T) {
+	root := NewMemoryDriver()
+	tmp := NewMemoryDriver()
+	media := NewMemoryDriver()
+
+	driver := NewMountDriver()
+	driver.Mount("/", root)
+	driver.Mount("/tmp/", tmp)
+	driver.Mount("/media", media)
+
+	// Test Write is routed by prefix and the prefix is stripped
+	err := driver.Write("/tmp/cache.txt", []byte("cache"))
+	assert.NoError(t, err)
+	err = driver.Write("/media/photo.jpg", []byte("photo"))
+	assert.NoError(t, err)
+	err = driver.Write("/notes.txt", []byte("notes"))
+	assert.NoError(t, err)
+
+	_, err = tmp.Read("cache.txt")
+	assert.NoError(t, err)
+	_, err = media.Read("photo.jpg")
+	assert.NoError(t, err)
+	_, err = root.Read("notes.txt")
+	assert.NoError(t, err)
+
+	// Test Read through the mount table
+	reader, err := driver.Read("/media/photo.jpg")
+	assert.NoError(t, err)
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("photo"), data)
+
+	// Test a prefix that only looks like a mount goes to the root
+	err = driver.Put("/tmpfile.txt", []byte("root"))
+	assert.NoError(t, err)
+	_, err = root.Read("tmpfile.txt")
+	assert.NoError(t, err)
+
+	// Test Copy across mounts
+	err = driver.Copy("/media/photo.jpg", "/tmp/photo.jpg")
+	assert.NoError(t, err)
+
+	reader, err = tmp.Read("photo.jpg")
+	assert.NoError(t, err)
+
+	data, err = io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("photo"), data)
+
+	// Test Move across mounts
+	err = driver.Move("/notes.txt", "/media/notes.txt")
+	assert.NoError(t, err)
+
+	_, err = root.Read("notes.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+	_, err = media.Read("notes.txt")
+	assert.NoError(t, err)
+
+	// Test Move onto the same file keeps it
+	err = driver.Move("/media/notes.txt", "media/notes.txt")
+	assert.NoError(t, err)
+	_, err = media.Read("notes.txt")
+	assert.NoError(t, err)
+
+	err = driver.Move("/media/missing.txt", "/media/missing.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+
+	// Test List merges mounts and hides files shadowed by a mount
+	err = root.Put("tmp/shadowed.txt", []byte("hidden"))
+	assert.NoError(t, err)
+
+	paths, err := driver.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"media/notes.txt",
+		"media/photo.jpg",
+		"tmp/cache.txt",
+		"tmp/photo.jpg",
+		"tmpfile.txt",
+	}, paths)
+
+	paths, err = driver.List("/tmp/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tmp/cache.txt", "tmp/photo.jpg"}, paths)
+
+	paths, err = driver.List("tmp/c")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tmp/cache.txt"}, paths)
+
+	// Test Delete
+	err = driver.Delete("/tmp/cache.txt")
+	assert.NoError(t, err)
+	_, err = tmp.Read("cache.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+}
+
+func TestMountDriverErrors(t *testing.T) {
+	driver := NewMountDriver()
+	driver.Mount("/tmp", NewMemoryDriver())
+
+	// Test paths without a mount
+	_, err := driver.Read("/other/file.txt")
+	assert.Equal(t, errors.ErrNotMounted, err)
+
+	err = driver.Put("/other/file.txt", []byte("test"))
+	assert.Equal(t, errors.ErrNotMounted, err)
+
+	// Test Unmount
+	driver.Unmount("/tmp")
+	err = driver.Put("/tmp/file.txt", []byte("test"))
+	assert.Equal(t, errors.ErrNotMounted, err)
+
+	// Test List on a driver that cannot list
+	driver.Mount("/plain", NewReadOnlyDriver(struct{ Driver }{NewMemoryDriver()}))
+	_, err = driver.List("/plain")
+	assert.Equal(t, errors.ErrNotSupported, err)
+}
@@ -0,0 +1,248 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// whiteoutPrefix marks a file in the upper layer as deleted, hiding any copy
+// of it in the lower layers, the same way overlayfs does.
+const whiteoutPrefix = ".wh."
+
+// OverlayDriver stacks a writable upper layer over read-only lower layers.
+// Reads fall through the layers top to bottom, every change lands in the
+// upper layer and lower layers are never modified. Whiteout markers are
+// managed by the overlay itself and cannot be touched through it.
+type OverlayDriver struct {
+	upper  Driver
+	lowers []Driver
+}
+
+func NewOverlayDriver(upper Driver, lowers ...Driver) *OverlayDriver {
+	return &OverlayDriver{
+		upper:  upper,
+		lowers: lowers,
+	}
+}
+
+func (d *OverlayDriver) Read(path string) (io.ReadCloser, error) {
+	if isWhiteout(path) {
+		return nil, errors.ErrPermissionDenied
+	}
+
+	reader, err := d.upper.Read(path)
+	if err != errors.ErrFileNotFound {
+		return reader, err
+	}
+
+	if d.whitedOut(path) {
+		return nil, errors.ErrFileNotFound
+	}
+
+	for _, lower := range d.lowers {
+		reader, err := lower.Read(path)
+		if err != errors.ErrFileNotFound {
+			return reader, err
+		}
+	}
+
+	return nil, errors.ErrFileNotFound
+}
+
+func (d *OverlayDriver) Write(path string, data []byte) error {
+	if isWhiteout(path) {
+		return errors.ErrPermissionDenied
+	}
+
+	exists, err := d.exists(path)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return errors.ErrFileExists
+	}
+
+	return d.Put(path, data)
+}
+
+func (d *OverlayDriver) Put(path string, data []byte) error {
+	if isWhiteout(path) {
+		return errors.ErrPermissionDenied
+	}
+
+	if err := d.upper.Put(path, data); err != nil {
+		return err
+	}
+
+	return d.removeWhiteout(path)
+}
+
+func (d *OverlayDriver) Delete(path string) error {
+	if isWhiteout(path) {
+		return errors.ErrPermissionDenied
+	}
+
+	upperErr := d.upper.Delete(path)
+	if upperErr != nil && upperErr != errors.ErrFileNotFound {
+		return upperErr
+	}
+
+	inLower, err := d.inLower(path)
+	if err != nil {
+		return err
+	}
+
+	if !inLower {
+		return upperErr
+	}
+
+	if upperErr == errors.ErrFileNotFound && d.whitedOut(path) {
+		return errors.ErrFileNotFound
+	}
+
+	return d.upper.Put(whiteoutPath(path), []byte{})
+}
+
+func (d *OverlayDriver) Update(path string, data []byte, prepend bool) error {
+	if isWhiteout(path) {
+		return errors.ErrPermissionDenied
+	}
+
+	reader, err := d.upper.Read(path)
+	if err == nil {
+		reader.Close()
+		return d.upper.Update(path, data, prepend)
+	}
+
+	if err != errors.ErrFileNotFound {
+		return err
+	}
+
+	// Copy up: the file only exists below, so the upper layer gets the
+	// complete new content
+	reader, err = d.Read(path)
+	if err == errors.ErrFileNotFound {
+		return d.Put(path, data)
+	}
+
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	existingData, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	return d.Put(path, applyUpdate(existingData, data, prepend))
+}
+
+// List merges all layers, hiding whiteouts and the files they cover.
+func (d *OverlayDriver) List(prefix string) ([]string, error) {
+	upperFiles, err := listFiles(d.upper, "")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	hidden := make(map[string]bool)
+	paths := make([]string, 0)
+
+	for _, file := range upperFiles {
+		if isWhiteout(file) {
+			hidden[unwhiteoutPath(file)] = true
+			continue
+		}
+
+		if strings.HasPrefix(file, prefix) {
+			seen[file] = true
+			paths = append(paths, file)
+		}
+	}
+
+	for _, lower := range d.lowers {
+		files, err := listFiles(lower, prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			if !seen[file] && !hidden[file] {
+				seen[file] = true
+				paths = append(paths, file)
+			}
+		}
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (d *OverlayDriver) exists(path string) (bool, error) {
+	reader, err := d.Read(path)
+	if err == errors.ErrFileNotFound {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	reader.Close()
+	return true, nil
+}
+
+func (d *OverlayDriver) inLower(path string) (bool, error) {
+	for _, lower := range d.lowers {
+		reader, err := lower.Read(path)
+		if err == errors.ErrFileNotFound {
+			continue
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		reader.Close()
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (d *OverlayDriver) whitedOut(path string) bool {
+	reader, err := d.upper.Read(whiteoutPath(path))
+	if err != nil {
+		return false
+	}
+
+	reader.Close()
+	return true
+}
+
+func (d *OverlayDriver) removeWhiteout(path string) error {
+	err := d.upper.Delete(whiteoutPath(path))
+	if err == errors.ErrFileNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func whiteoutPath(path string) string {
+	i := strings.LastIndex(path, "/")
+	return path[:i+1] + whiteoutPrefix + path[i+1:]
+}
+
+func unwhiteoutPath(path string) string {
+	i := strings.LastIndex(path, "/")
+	return path[:i+1] + strings.TrimPrefix(path[i+1:], whiteoutPrefix)
+}
+
+func isWhiteout(path string) bool {
+	return strings.HasPrefix(path[strings.LastIndex(path, "/")+1:], whiteoutPrefix)
+}
@@ -0,0 +1,144 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readString(t *testing.T, driver Driver, path string) string {
+	t.Helper()
+
+	reader, err := driver.Read(path)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+
+	return string(data)
+}
+
+func TestOverlayDriver(t *testing.T) {
+	base := NewMemoryDriver()
+	assert.NoError(t, base.Write("config.txt", []byte("base config")))
+	assert.NoError(t, base.Write("log.txt", []byte("base log")))
+	assert.NoError(t, base.Write("old.txt", []byte("old")))
+
+	upper := NewMemoryDriver()
+	driver := NewOverlayDriver(upper, base)
+
+	// Test Read falls through to the base layer
+	assert.Equal(t, "base config", readString(t, driver, "config.txt"))
+
+	// Test Write refuses files visible in any layer
+	err := driver.Write("config.txt", []byte("new"))
+	assert.Equal(t, errors.ErrFileExists, err)
+
+	err = driver.Write("new.txt", []byte("new"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new", readString(t, upper, "new.txt"))
+
+	// Test Put lands in the upper layer
+	err = driver.Put("config.txt", []byte("upper config"))
+	assert.NoError(t, err)
+	assert.Equal(t, "upper config", readString(t, driver, "config.txt"))
+	assert.Equal(t, "base config", readString(t, base, "config.txt"))
+
+	// Test Update copies up the base content
+	err = driver.Update("log.txt", []byte(" appended"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "base log appended", readString(t, driver, "log.txt"))
+
+	err = driver.Update("log.txt", []byte("prepended "), true)
+	assert.NoError(t, err)
+	assert.Equal(t, "prepended base log appended", readString(t, driver, "log.txt"))
+	assert.Equal(t, "base log", readString(t, base, "log.txt"))
+
+	// Test Delete hides base files behind a whiteout
+	err = driver.Delete("old.txt")
+	assert.NoError(t, err)
+
+	_, err = driver.Read("old.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+	assert.Equal(t, "old", readString(t, base, "old.txt"))
+
+	err = driver.Delete("old.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+
+	// Test Delete of a copied-up file also hides the base copy
+	err = driver.Delete("config.txt")
+	assert.NoError(t, err)
+
+	_, err = driver.Read("config.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+
+	// Test List merges layers and skips whiteouts
+	paths, err := driver.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"log.txt", "new.txt"}, paths)
+
+	// Test writing a whited-out file brings it back
+	err = driver.Write("old.txt", []byte("recreated"))
+	assert.NoError(t, err)
+	assert.Equal(t, "recreated", readString(t, driver, "old.txt"))
+
+	paths, err = driver.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"log.txt", "new.txt", "old.txt"}, paths)
+}
+
+func TestOverlayDriverLayers(t *testing.T) {
+	bottom := NewMemoryDriver()
+	assert.NoError(t, bottom.Write("dir/file.txt", []byte("bottom")))
+	assert.NoError(t, bottom.Write("dir/only-bottom.txt", []byte("bottom")))
+
+	middle := NewMemoryDriver()
+	assert.NoError(t, middle.Write("dir/file.txt", []byte("middle")))
+
+	driver := NewOverlayDriver(NewMemoryDriver(), middle, bottom)
+
+	// Test the first layer holding the file wins
+	assert.Equal(t, "middle", readString(t, driver, "dir/file.txt"))
+	assert.Equal(t, "bottom", readString(t, driver, "dir/only-bottom.txt"))
+
+	// Test whiteouts in nested directories
+	err := driver.Delete("dir/file.txt")
+	assert.NoError(t, err)
+
+	_, err = driver.Read("dir/file.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+
+	paths, err := driver.List("dir/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dir/only-bottom.txt"}, paths)
+
+	// Test deleting a file that exists nowhere
+	err = driver.Delete("missing.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+}
+
+func TestOverlayDriverWhiteoutPaths(t *testing.T) {
+	base := NewMemoryDriver()
+	assert.NoError(t, base.Write("dir/x", []byte("x")))
+	assert.NoError(t, base.Write("y", []byte("y")))
+
+	driver := NewOverlayDriver(NewMemoryDriver(), base)
+	assert.NoError(t, driver.Delete("dir/x"))
+
+	// Test whiteouts cannot be read, removed or forged
+	_, err := driver.Read("dir/.wh.x")
+	assert.Equal(t, errors.ErrPermissionDenied, err)
+	assert.Equal(t, errors.ErrPermissionDenied, driver.Delete("dir/.wh.x"))
+	assert.Equal(t, errors.ErrPermissionDenied, driver.Put(".wh.y", []byte{}))
+	assert.Equal(t, errors.ErrPermissionDenied, driver.Write(".wh.z", []byte{}))
+	assert.Equal(t, errors.ErrPermissionDenied, driver.Update(".wh.y", []byte{}, false))
+
+	_, err = driver.Read("dir/x")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+	assert.Equal(t, "y", readString(t, driver, "y"))
+}
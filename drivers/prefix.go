@@ -0,0 +1,100 @@
+package drivers
+
+import (
+	"io"
+	"strings"
+)
+
+// PrefixDriver keeps every file under a base path of the wrapped driver,
+// like a chroot. Paths that would climb out of it with ".." are refused
+// with ErrPermissionDenied, and List results come back without the prefix.
+type PrefixDriver struct {
+	driver Driver
+	prefix string
+}
+
+func NewPrefixDriver(driver Driver, prefix string) *PrefixDriver {
+	return &PrefixDriver{
+		driver: driver,
+		prefix: strings.Trim(prefix, "/"),
+	}
+}
+
+func (d *PrefixDriver) Read(path string) (io.ReadCloser, error) {
+	fullPath, err := d.fullPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.driver.Read(fullPath)
+}
+
+func (d *PrefixDriver) Write(path string, data []byte) error {
+	fullPath, err := d.fullPath(path)
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Write(fullPath, data)
+}
+
+func (d *PrefixDriver) Put(path string, data []byte) error {
+	fullPath, err := d.fullPath(path)
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Put(fullPath, data)
+}
+
+func (d *PrefixDriver) Delete(path string) error {
+	fullPath, err := d.fullPath(path)
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Delete(fullPath)
+}
+
+func (d *PrefixDriver) Update(path string, data []byte, prepend bool) error {
+	fullPath, err := d.fullPath(path)
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Update(fullPath, data, prepend)
+}
+
+func (d *PrefixDriver) List(prefix string) ([]string, error) {
+	fullPrefix, err := d.fullPath(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := listFiles(d.driver, fullPrefix)
+	if err != nil || d.prefix == "" {
+		return paths, err
+	}
+
+	stripped := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if relative, found := strings.CutPrefix(path, d.prefix+"/"); found {
+			stripped = append(stripped, relative)
+		}
+	}
+
+	return stripped, nil
+}
+
+func (d *PrefixDriver) fullPath(name string) (string, error) {
+	relative, err := cleanPath(name)
+	if err != nil {
+		return "", err
+	}
+
+	if d.prefix == "" {
+		return name, nil
+	}
+
+	return d.prefix + "/" + relative, nil
+}
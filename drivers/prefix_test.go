@@ -0,0 +1,95 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixDriver(t *testing.T) {
+	memory := NewMemoryDriver()
+	driver := NewPrefixDriver(memory, "/tenants/a/")
+
+	// Test Write lands under the prefix
+	testData := []byte("Hello, Prefix!")
+	err := driver.Write("test.txt", testData)
+	assert.NoError(t, err)
+
+	reader, err := memory.Read("tenants/a/test.txt")
+	assert.NoError(t, err)
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, testData, data)
+
+	// Test Read through the prefix
+	reader, err = driver.Read("/test.txt")
+	assert.NoError(t, err)
+
+	data, err = io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, testData, data)
+
+	// Test Update (append)
+	err = driver.Update("test.txt", []byte(" Appended"), false)
+	assert.NoError(t, err)
+
+	reader, err = memory.Read("tenants/a/test.txt")
+	assert.NoError(t, err)
+
+	data, err = io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("Hello, Prefix! Appended"), data)
+
+	// Test Delete
+	err = driver.Delete("test.txt")
+	assert.NoError(t, err)
+
+	_, err = memory.Read("tenants/a/test.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+}
+
+func TestPrefixDriverEscape(t *testing.T) {
+	memory := NewMemoryDriver()
+	memory.Put("tenants/b/secret.txt", []byte("secret"))
+
+	driver := NewPrefixDriver(memory, "tenants/a")
+
+	_, err := driver.Read("../b/secret.txt")
+	assert.Equal(t, errors.ErrPermissionDenied, err)
+
+	_, err = driver.Read("/docs/../../b/secret.txt")
+	assert.Equal(t, errors.ErrPermissionDenied, err)
+
+	assert.Equal(t, errors.ErrPermissionDenied, driver.Put("..", []byte("x")))
+	assert.Equal(t, errors.ErrPermissionDenied, driver.Delete("a/../../b/secret.txt"))
+
+	_, err = driver.List("../")
+	assert.Equal(t, errors.ErrPermissionDenied, err)
+
+	// Climbing back down inside the prefix is fine
+	assert.NoError(t, driver.Put("docs/../readme.txt", []byte("readme")))
+	assert.Equal(t, "readme", readString(t, memory, "tenants/a/readme.txt"))
+}
+
+func TestPrefixDriverList(t *testing.T) {
+	memory := NewMemoryDriver()
+	memory.Put("tenants/a/one.txt", []byte("1"))
+	memory.Put("tenants/a/docs/two.txt", []byte("2"))
+	memory.Put("tenants/ab/other.txt", []byte("x"))
+
+	driver := NewPrefixDriver(memory, "tenants/a")
+
+	paths, err := driver.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docs/two.txt", "one.txt"}, paths)
+
+	paths, err = driver.List("docs/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"docs/two.txt"}, paths)
+}
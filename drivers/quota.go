@@ -0,0 +1,318 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+type Quota struct {
+	Prefix   string // "" applies to every path
+	MaxBytes int64  // 0 for no limit
+	MaxFiles int64  // 0 for no limit
+}
+
+type QuotaOptions struct {
+	Quotas      []Quota
+	MaxFileSize int64 // 0 for no limit
+}
+
+type Usage struct {
+	Bytes int64
+	Files int64
+}
+
+// QuotaDriver tracks the bytes and files stored under each quota prefix
+// and rejects changes that would exceed a limit with an
+// *errors.QuotaError. Files that existed before the wrapper are counted
+// when they are first touched, or all at once by Recompute.
+type QuotaDriver struct {
+	driver Driver
+	opts   QuotaOptions
+	sizes  map[string]int64
+	usage  map[string]*Usage
+	mutex  sync.Mutex
+}
+
+func NewQuotaDriver(driver Driver, opts QuotaOptions) *QuotaDriver {
+	d := &QuotaDriver{
+		driver: driver,
+		opts:   opts,
+		sizes:  make(map[string]int64),
+		usage:  make(map[string]*Usage),
+	}
+
+	for _, quota := range opts.Quotas {
+		d.usage[quota.Prefix] = &Usage{}
+	}
+
+	return d
+}
+
+func (d *QuotaDriver) Read(path string) (io.ReadCloser, error) {
+	return d.driver.Read(path)
+}
+
+func (d *QuotaDriver) Write(path string, data []byte) error {
+	undo, err := d.reserve(path, func(int64) int64 { return int64(len(data)) })
+	if err != nil {
+		return err
+	}
+
+	if err := d.driver.Write(path, data); err != nil {
+		undo()
+		return err
+	}
+
+	return nil
+}
+
+func (d *QuotaDriver) Put(path string, data []byte) error {
+	if err := d.track(path); err != nil {
+		return err
+	}
+
+	undo, err := d.reserve(path, func(int64) int64 { return int64(len(data)) })
+	if err != nil {
+		return err
+	}
+
+	if err := d.driver.Put(path, data); err != nil {
+		undo()
+		return err
+	}
+
+	return nil
+}
+
+func (d *QuotaDriver) Delete(path string) error {
+	if err := d.track(path); err != nil {
+		return err
+	}
+
+	if err := d.driver.Delete(path); err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	key := quotaKey(path)
+	if _, exists := d.sizes[key]; exists {
+		d.apply(key, 0, -1)
+		delete(d.sizes, key)
+	}
+
+	return nil
+}
+
+func (d *QuotaDriver) Update(path string, data []byte, prepend bool) error {
+	if err := d.track(path); err != nil {
+		return err
+	}
+
+	undo, err := d.reserve(path, func(old int64) int64 { return old + int64(len(data)) })
+	if err != nil {
+		return err
+	}
+
+	if err := d.driver.Update(path, data, prepend); err != nil {
+		undo()
+		return err
+	}
+
+	return nil
+}
+
+func (d *QuotaDriver) List(prefix string) ([]string, error) {
+	return listFiles(d.driver, prefix)
+}
+
+// Usage returns the tracked usage of a configured quota prefix.
+func (d *QuotaDriver) Usage(prefix string) Usage {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if usage, exists := d.usage[prefix]; exists {
+		return *usage
+	}
+
+	return Usage{}
+}
+
+// Recompute rebuilds usage from a full scan of the wrapped driver, which
+// must implement Lister.
+func (d *QuotaDriver) Recompute() error {
+	paths, err := listFiles(d.driver, "")
+	if err != nil {
+		return err
+	}
+
+	sizes := make(map[string]int64, len(paths))
+	for _, path := range paths {
+		size, err := readSize(d.driver, path)
+		if err != nil {
+			return err
+		}
+		sizes[quotaKey(path)] = size
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.sizes = make(map[string]int64, len(sizes))
+	for _, usage := range d.usage {
+		*usage = Usage{}
+	}
+
+	for path, size := range sizes {
+		d.apply(path, size, 1)
+	}
+
+	return nil
+}
+
+func (d *QuotaDriver) check(path string, size, deltaBytes, deltaFiles int64) error {
+	if d.opts.MaxFileSize > 0 && size > d.opts.MaxFileSize {
+		return &errors.QuotaError{
+			Prefix:    path,
+			Limit:     "file_size",
+			Max:       d.opts.MaxFileSize,
+			Requested: size,
+		}
+	}
+
+	for _, quota := range d.opts.Quotas {
+		if !quotaCovers(quota.Prefix, path) {
+			continue
+		}
+
+		usage := d.usage[quota.Prefix]
+
+		if quota.MaxBytes > 0 && deltaBytes > 0 && usage.Bytes+deltaBytes > quota.MaxBytes {
+			return &errors.QuotaError{
+				Prefix:    quota.Prefix,
+				Limit:     "bytes",
+				Max:       quota.MaxBytes,
+				Requested: usage.Bytes + deltaBytes,
+			}
+		}
+
+		if quota.MaxFiles > 0 && deltaFiles > 0 && usage.Files+deltaFiles > quota.MaxFiles {
+			return &errors.QuotaError{
+				Prefix:    quota.Prefix,
+				Limit:     "files",
+				Max:       quota.MaxFiles,
+				Requested: usage.Files + deltaFiles,
+			}
+		}
+	}
+
+	return nil
+}
+
+// apply records that path now holds size bytes and adds deltaFiles to the
+// file count of every quota covering it.
+func (d *QuotaDriver) apply(path string, size, deltaFiles int64) {
+	deltaBytes := size - d.sizes[path]
+	d.sizes[path] = size
+
+	for _, quota := range d.opts.Quotas {
+		if quotaCovers(quota.Prefix, path) {
+			usage := d.usage[quota.Prefix]
+			usage.Bytes += deltaBytes
+			usage.Files += deltaFiles
+		}
+	}
+}
+
+// reserve checks a change to path against the quotas and books it before
+// the wrapped driver runs it, so concurrent changes cannot overshoot a
+// limit together. size maps the current size to the new one. The returned
+// function takes the booking back when the change fails.
+func (d *QuotaDriver) reserve(path string, size func(old int64) int64) (func(), error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	key := quotaKey(path)
+	oldSize, exists := d.sizes[key]
+	newSize := size(oldSize)
+
+	files := int64(1)
+	if exists {
+		files = 0
+	}
+
+	if err := d.check(key, newSize, newSize-oldSize, files); err != nil {
+		return nil, err
+	}
+	d.apply(key, newSize, files)
+
+	return func() {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+
+		d.apply(key, oldSize, -files)
+		if !exists {
+			delete(d.sizes, key)
+		}
+	}, nil
+}
+
+// track counts a file that existed before the wrapper the first time it is
+// touched, so later changes to it balance out.
+func (d *QuotaDriver) track(path string) error {
+	key := quotaKey(path)
+
+	d.mutex.Lock()
+	_, known := d.sizes[key]
+	d.mutex.Unlock()
+
+	if known {
+		return nil
+	}
+
+	size, err := readSize(d.driver, path)
+	if err == errors.ErrFileNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, known := d.sizes[key]; !known {
+		d.apply(key, size, 1)
+	}
+
+	return nil
+}
+
+// quotaKey is the path as tracked, without the leading slash drivers
+// ignore.
+func quotaKey(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+// quotaCovers reports whether path lies under prefix, matching whole path
+// segments so "tenant1" does not cover "tenant10/file".
+func quotaCovers(prefix, path string) bool {
+	prefix = strings.Trim(prefix, "/")
+	path = strings.TrimPrefix(path, "/")
+
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func readSize(driver Driver, path string) (int64, error) {
+	reader, err := driver.Read(path)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	return io.Copy(io.Discard, reader)
+}
@@ -0,0 +1,161 @@
+package drivers
+
+import (
+	goerrors "errors"
+	"github.com/vanvanni/lampofs/errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaDriver(t *testing.T) {
+	driver := NewQuotaDriver(NewMemoryDriver(), QuotaOptions{
+		Quotas: []Quota{
+			{Prefix: "tenants/a/", MaxBytes: 10, MaxFiles: 2},
+			{Prefix: "", MaxBytes: 100},
+		},
+		MaxFileSize: 20,
+	})
+
+	// Test usage is tracked per prefix
+	assert.NoError(t, driver.Write("tenants/a/one.txt", []byte("12345")))
+	assert.NoError(t, driver.Write("tenants/b/one.txt", []byte("12345")))
+	assert.Equal(t, Usage{Bytes: 5, Files: 1}, driver.Usage("tenants/a/"))
+	assert.Equal(t, Usage{Bytes: 10, Files: 2}, driver.Usage(""))
+
+	// Test the byte limit
+	err := driver.Write("tenants/a/two.txt", []byte("123456"))
+	assert.ErrorIs(t, err, errors.ErrQuotaExceeded)
+
+	var quotaErr *errors.QuotaError
+	assert.True(t, goerrors.As(err, &quotaErr))
+	assert.Equal(t, "tenants/a/", quotaErr.Prefix)
+	assert.Equal(t, "bytes", quotaErr.Limit)
+	assert.Equal(t, int64(10), quotaErr.Max)
+	assert.Equal(t, int64(11), quotaErr.Requested)
+
+	// Test Put counts only the difference
+	assert.NoError(t, driver.Put("tenants/a/one.txt", []byte("1234567890")))
+	assert.Equal(t, Usage{Bytes: 10, Files: 1}, driver.Usage("tenants/a/"))
+
+	assert.NoError(t, driver.Put("tenants/a/one.txt", []byte("123")))
+	assert.Equal(t, Usage{Bytes: 3, Files: 1}, driver.Usage("tenants/a/"))
+
+	// Test the file count limit
+	assert.NoError(t, driver.Write("tenants/a/two.txt", []byte("1")))
+	err = driver.Update("tenants/a/three.txt", []byte("1"), false)
+	assert.True(t, goerrors.As(err, &quotaErr))
+	assert.Equal(t, "files", quotaErr.Limit)
+
+	// Test Update grows the file
+	err = driver.Update("tenants/a/two.txt", []byte("234567"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, Usage{Bytes: 10, Files: 2}, driver.Usage("tenants/a/"))
+
+	err = driver.Update("tenants/a/two.txt", []byte("8"), true)
+	assert.ErrorIs(t, err, errors.ErrQuotaExceeded)
+
+	// Test the maximum file size
+	err = driver.Put("tenants/b/big.txt", make([]byte, 21))
+	assert.True(t, goerrors.As(err, &quotaErr))
+	assert.Equal(t, "file_size", quotaErr.Limit)
+
+	// Test Delete frees space
+	assert.NoError(t, driver.Delete("tenants/a/one.txt"))
+	assert.Equal(t, Usage{Bytes: 7, Files: 1}, driver.Usage("tenants/a/"))
+	assert.Equal(t, errors.ErrFileNotFound, driver.Delete("tenants/a/one.txt"))
+	assert.Equal(t, Usage{Bytes: 7, Files: 1}, driver.Usage("tenants/a/"))
+}
+
+func TestQuotaDriverRecompute(t *testing.T) {
+	backend := NewMemoryDriver()
+	assert.NoError(t, backend.Write("tenants/a/one.txt", []byte("12345")))
+	assert.NoError(t, backend.Write("tenants/a/two.txt", []byte("12345")))
+	assert.NoError(t, backend.Write("tenants/b/one.txt", []byte("12")))
+
+	driver := NewQuotaDriver(backend, QuotaOptions{
+		Quotas: []Quota{{Prefix: "tenants/a/", MaxBytes: 12}},
+	})
+
+	// Test files written before the wrapper are found on first touch
+	assert.NoError(t, driver.Put("tenants/a/one.txt", []byte("1234567")))
+	assert.Equal(t, Usage{Bytes: 7, Files: 1}, driver.Usage("tenants/a/"))
+
+	// Test Recompute counts everything
+	assert.NoError(t, driver.Recompute())
+	assert.Equal(t, Usage{Bytes: 12, Files: 2}, driver.Usage("tenants/a/"))
+
+	err := driver.Update("tenants/a/two.txt", []byte("1"), false)
+	assert.ErrorIs(t, err, errors.ErrQuotaExceeded)
+
+	assert.Equal(t, Usage{}, driver.Usage("unknown/"))
+}
+
+func TestQuotaDriverPrefixBoundaries(t *testing.T) {
+	driver := NewQuotaDriver(NewMemoryDriver(), QuotaOptions{
+		Quotas: []Quota{{Prefix: "tenant1", MaxBytes: 5}},
+	})
+
+	// Test a sibling sharing the name prefix is not counted
+	assert.NoError(t, driver.Write("tenant10/big.txt", []byte("1234567890")))
+	assert.Equal(t, Usage{}, driver.Usage("tenant1"))
+
+	// Test leading slashes are ignored
+	assert.NoError(t, driver.Write("/tenant1/a.txt", []byte("123")))
+	assert.Equal(t, Usage{Bytes: 3, Files: 1}, driver.Usage("tenant1"))
+
+	err := driver.Put("/tenant1/a.txt", []byte("123456"))
+	assert.ErrorIs(t, err, errors.ErrQuotaExceeded)
+
+	assert.NoError(t, driver.Delete("/tenant1/a.txt"))
+	assert.Equal(t, Usage{}, driver.Usage("tenant1"))
+}
+
+func TestQuotaDriverNormalizesPaths(t *testing.T) {
+	local, err := NewLocalDriver(t.TempDir())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	driver := NewQuotaDriver(local, QuotaOptions{
+		Quotas: []Quota{{Prefix: "docs", MaxFiles: 1}},
+	})
+
+	// Test "a" and "/a" are the same file on disk and in the usage
+	assert.NoError(t, driver.Put("docs/a.txt", []byte("123")))
+	assert.NoError(t, driver.Put("/docs/a.txt", []byte("12345")))
+	assert.Equal(t, Usage{Bytes: 5, Files: 1}, driver.Usage("docs"))
+
+	assert.NoError(t, driver.Update("/docs/a.txt", []byte("6"), false))
+	assert.Equal(t, Usage{Bytes: 6, Files: 1}, driver.Usage("docs"))
+
+	assert.NoError(t, driver.Delete("docs/a.txt"))
+	assert.Equal(t, Usage{}, driver.Usage("docs"))
+}
+
+func TestQuotaDriverSlowPut(t *testing.T) {
+	backend := &blockingPutDriver{
+		Driver:  NewMemoryDriver(),
+		path:    "a/slow.txt",
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	driver := NewQuotaDriver(backend, QuotaOptions{
+		Quotas: []Quota{{Prefix: "a", MaxBytes: 10}},
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- driver.Put("a/slow.txt", []byte("123456"))
+	}()
+	<-backend.started
+
+	// Test other calls do not wait for the stuck Put, which already counts
+	assert.NoError(t, driver.Put("b/fast.txt", []byte("1")))
+	assert.ErrorIs(t, driver.Put("a/other.txt", []byte("12345")), errors.ErrQuotaExceeded)
+	assert.Equal(t, Usage{Bytes: 6, Files: 1}, driver.Usage("a"))
+
+	close(backend.release)
+	assert.NoError(t, <-done)
+	assert.Equal(t, Usage{Bytes: 6, Files: 1}, driver.Usage("a"))
+}
@@ -0,0 +1,42 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+)
+
+// ReadOnlyDriver serves reads and rejects every change with
+// ErrPermissionDenied. See WORMDriver for files that may be written once.
+type ReadOnlyDriver struct {
+	driver Driver
+}
+
+func NewReadOnlyDriver(driver Driver) *ReadOnlyDriver {
+	return &ReadOnlyDriver{
+		driver: driver,
+	}
+}
+
+func (d *ReadOnlyDriver) Read(path string) (io.ReadCloser, error) {
+	return d.driver.Read(path)
+}
+
+func (d *ReadOnlyDriver) Write(path string, data []byte) error {
+	return errors.ErrPermissionDenied
+}
+
+func (d *ReadOnlyDriver) Put(path string, data []byte) error {
+	return errors.ErrPermissionDenied
+}
+
+func (d *ReadOnlyDriver) Delete(path string) error {
+	return errors.ErrPermissionDenied
+}
+
+func (d *ReadOnlyDriver) Update(path string, data []byte, prepend bool) error {
+	return errors.ErrPermissionDenied
+}
+
+func (d *ReadOnlyDriver) List(prefix string) ([]string, error) {
+	return listFiles(d.driver, prefix)
+}
@@ -0,0 +1,41 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnlyDriver(t *testing.T) {
+	memory := NewMemoryDriver()
+	err := memory.Write("test.txt", []byte("Hello, ReadOnly!"))
+	assert.NoError(t, err)
+
+	driver := NewReadOnlyDriver(memory)
+
+	// Test Read
+	reader, err := driver.Read("test.txt")
+	assert.NoError(t, err)
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("Hello, ReadOnly!"), data)
+
+	// Test mutations are rejected
+	assert.Equal(t, errors.ErrPermissionDenied, driver.Write("new.txt", []byte("test")))
+	assert.Equal(t, errors.ErrPermissionDenied, driver.Put("test.txt", []byte("test")))
+	assert.Equal(t, errors.ErrPermissionDenied, driver.Update("test.txt", []byte("test"), false))
+	assert.Equal(t, errors.ErrPermissionDenied, driver.Delete("test.txt"))
+
+	// Verify the underlying file is untouched
+	reader, err = memory.Read("test.txt")
+	assert.NoError(t, err)
+
+	data, err = io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("Hello, ReadOnly!"), data)
+}
@@ -0,0 +1,420 @@
+package drivers
+
+import (
+	goerrors "errors"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Consistency int
+
+const (
+	// ConsistencyAll succeeds only when every replica accepted the change.
+	ConsistencyAll Consistency = iota
+	// ConsistencyQuorum succeeds once a majority of replicas accepted it.
+	ConsistencyQuorum
+	// ConsistencyPrimary waits for the first replica and copies to the rest
+	// in the background, keeping each replica's changes in order.
+	ConsistencyPrimary
+)
+
+// ReplicaDriver mirrors every change to all replicas. Replicas that miss a
+// change are recorded as divergent until Reconcile repairs them.
+type ReplicaDriver struct {
+	replicas    []Driver
+	consistency Consistency
+
+	unhealthy   map[int]bool
+	divergences map[divergenceKey]Divergence
+	queues      []*replicaQueue
+	mutex       sync.Mutex
+	pending     sync.WaitGroup
+}
+
+// replicaQueue applies background changes to one replica in the order they
+// were made. A worker runs while the queue has work.
+type replicaQueue struct {
+	jobs    []func()
+	running bool
+	mutex   sync.Mutex
+}
+
+type Divergence struct {
+	Path      string
+	Replica   int
+	Operation string // WRITE, PUT, DELETE, UPDATE
+	Err       error
+	Timestamp int64
+}
+
+type divergenceKey struct {
+	path    string
+	replica int
+}
+
+func NewReplicaDriver(consistency Consistency, replicas ...Driver) *ReplicaDriver {
+	queues := make([]*replicaQueue, len(replicas))
+	for i := range queues {
+		queues[i] = &replicaQueue{}
+	}
+
+	return &ReplicaDriver{
+		replicas:    replicas,
+		consistency: consistency,
+		unhealthy:   make(map[int]bool),
+		divergences: make(map[divergenceKey]Divergence),
+		queues:      queues,
+	}
+}
+
+// Read serves the file from the first healthy replica that is not known to
+// be behind on it.
+func (d *ReplicaDriver) Read(path string) (io.ReadCloser, error) {
+	var lastErr error = errors.ErrFileNotFound
+
+	for _, i := range d.readOrder(path) {
+		reader, err := d.replicas[i].Read(path)
+		if err == nil {
+			d.markHealthy(i)
+			return reader, nil
+		}
+
+		if err == errors.ErrFileNotFound {
+			d.markHealthy(i)
+			return nil, err
+		}
+
+		d.markUnhealthy(i)
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+func (d *ReplicaDriver) Write(path string, data []byte) error {
+	return d.replicate("WRITE", path, func(driver Driver) error {
+		return driver.Write(path, data)
+	})
+}
+
+func (d *ReplicaDriver) Put(path string, data []byte) error {
+	return d.replicate("PUT", path, func(driver Driver) error {
+		return driver.Put(path, data)
+	})
+}
+
+func (d *ReplicaDriver) Delete(path string) error {
+	return d.replicate("DELETE", path, func(driver Driver) error {
+		return driver.Delete(path)
+	})
+}
+
+func (d *ReplicaDriver) Update(path string, data []byte, prepend bool) error {
+	return d.replicate("UPDATE", path, func(driver Driver) error {
+		return driver.Update(path, data, prepend)
+	})
+}
+
+func (d *ReplicaDriver) List(prefix string) ([]string, error) {
+	var lastErr error = errors.ErrNotSupported
+
+	for _, i := range d.readOrder("") {
+		paths, err := listFiles(d.replicas[i], prefix)
+		if err == nil {
+			return paths, nil
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// Wait blocks until background replication started under
+// ConsistencyPrimary has finished.
+func (d *ReplicaDriver) Wait() {
+	d.pending.Wait()
+}
+
+func (d *ReplicaDriver) Divergences() []Divergence {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	divergences := make([]Divergence, 0, len(d.divergences))
+	for _, divergence := range d.divergences {
+		divergences = append(divergences, divergence)
+	}
+
+	sort.Slice(divergences, func(i, j int) bool {
+		if divergences[i].Path != divergences[j].Path {
+			return divergences[i].Path < divergences[j].Path
+		}
+		return divergences[i].Replica < divergences[j].Replica
+	})
+
+	return divergences
+}
+
+// Reconcile copies the current content of every divergent path from an
+// in-sync replica, or deletes it when the missed change was a delete.
+// Repaired divergences are forgotten; the rest are returned as errors.
+func (d *ReplicaDriver) Reconcile() error {
+	d.Wait()
+
+	var errs []error
+	for _, divergence := range d.Divergences() {
+		if err := d.repair(divergence); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		d.mutex.Lock()
+		delete(d.divergences, divergenceKey{divergence.Path, divergence.Replica})
+		d.mutex.Unlock()
+	}
+
+	return goerrors.Join(errs...)
+}
+
+func (d *ReplicaDriver) repair(divergence Divergence) error {
+	target := d.replicas[divergence.Replica]
+
+	reader, err := d.readInSync(divergence.Path)
+	if err == errors.ErrFileNotFound {
+		err = target.Delete(divergence.Path)
+		if err == errors.ErrFileNotFound {
+			return nil
+		}
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	return target.Put(divergence.Path, data)
+}
+
+func (d *ReplicaDriver) readInSync(path string) (io.ReadCloser, error) {
+	var lastErr error = errors.ErrFileNotFound
+
+	for i, replica := range d.replicas {
+		if d.isDivergent(path, i) {
+			continue
+		}
+
+		reader, err := replica.Read(path)
+		if err == nil || err == errors.ErrFileNotFound {
+			return reader, err
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+func (d *ReplicaDriver) replicate(operation, path string, apply func(driver Driver) error) error {
+	if d.consistency == ConsistencyPrimary {
+		return d.replicateAsync(operation, path, apply)
+	}
+
+	errs := make([]error, len(d.replicas))
+
+	var wg sync.WaitGroup
+	for i, replica := range d.replicas {
+		wg.Add(1)
+		go func(i int, replica Driver) {
+			defer wg.Done()
+			errs[i] = apply(replica)
+		}(i, replica)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	var firstErr error
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		} else if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	// Nobody took the change, so the replicas still agree
+	if succeeded == 0 {
+		return firstErr
+	}
+
+	required := len(d.replicas)
+	if d.consistency == ConsistencyQuorum {
+		required = len(d.replicas)/2 + 1
+	}
+
+	// The change failed as a whole, so the replicas that took it are the
+	// ones out of step and Reconcile brings them back to the others
+	if succeeded < required {
+		for i, err := range errs {
+			if err == nil {
+				d.diverge(operation, path, i, firstErr)
+			} else if err != errors.ErrFileNotFound && err != errors.ErrFileExists {
+				d.markUnhealthy(i)
+			}
+		}
+		return firstErr
+	}
+
+	for i, err := range errs {
+		d.record(operation, path, i, err)
+	}
+
+	return nil
+}
+
+func (d *ReplicaDriver) replicateAsync(operation, path string, apply func(driver Driver) error) error {
+	if len(d.replicas) == 0 {
+		return nil
+	}
+
+	err := apply(d.replicas[0])
+	if err != nil {
+		return err
+	}
+	d.record(operation, path, 0, nil)
+
+	for i := 1; i < len(d.replicas); i++ {
+		replica := d.replicas[i]
+		d.enqueue(i, func() {
+			d.record(operation, path, i, apply(replica))
+		})
+	}
+
+	return nil
+}
+
+func (d *ReplicaDriver) enqueue(replica int, job func()) {
+	queue := d.queues[replica]
+	d.pending.Add(1)
+
+	queue.mutex.Lock()
+	queue.jobs = append(queue.jobs, job)
+	if queue.running {
+		queue.mutex.Unlock()
+		return
+	}
+	queue.running = true
+	queue.mutex.Unlock()
+
+	go d.drain(queue)
+}
+
+func (d *ReplicaDriver) drain(queue *replicaQueue) {
+	for {
+		queue.mutex.Lock()
+		if len(queue.jobs) == 0 {
+			queue.running = false
+			queue.mutex.Unlock()
+			return
+		}
+
+		job := queue.jobs[0]
+		queue.jobs = queue.jobs[1:]
+		queue.mutex.Unlock()
+
+		job()
+		d.pending.Done()
+	}
+}
+
+func (d *ReplicaDriver) record(operation, path string, replica int, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	key := divergenceKey{path, replica}
+	if err == nil {
+		// An update on a stale copy leaves it stale, anything else replaces it
+		if operation != "UPDATE" {
+			delete(d.divergences, key)
+		}
+		delete(d.unhealthy, replica)
+		return
+	}
+
+	d.divergences[key] = d.divergence(operation, path, replica, err)
+
+	if err != errors.ErrFileNotFound && err != errors.ErrFileExists {
+		d.unhealthy[replica] = true
+	}
+}
+
+// diverge marks a replica as behind on path without touching its health.
+func (d *ReplicaDriver) diverge(operation, path string, replica int, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.divergences[divergenceKey{path, replica}] = d.divergence(operation, path, replica, err)
+}
+
+func (d *ReplicaDriver) divergence(operation, path string, replica int, err error) Divergence {
+	return Divergence{
+		Path:      path,
+		Replica:   replica,
+		Operation: operation,
+		Err:       err,
+		Timestamp: time.Now().Unix(),
+	}
+}
+
+// readOrder skips replicas known to be behind on path and puts unhealthy
+// ones last, so a read still has somewhere to go when everything looks broken.
+func (d *ReplicaDriver) readOrder(path string) []int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	preferred := make([]int, 0, len(d.replicas))
+	fallback := make([]int, 0)
+
+	for i := range d.replicas {
+		_, divergent := d.divergences[divergenceKey{path, i}]
+		if divergent && path != "" {
+			continue
+		}
+
+		if d.unhealthy[i] {
+			fallback = append(fallback, i)
+		} else {
+			preferred = append(preferred, i)
+		}
+	}
+
+	return append(preferred, fallback...)
+}
+
+func (d *ReplicaDriver) isDivergent(path string, replica int) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	_, divergent := d.divergences[divergenceKey{path, replica}]
+	return divergent
+}
+
+func (d *ReplicaDriver) markHealthy(replica int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	delete(d.unhealthy, replica)
+}
+
+func (d *ReplicaDriver) markUnhealthy(replica int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.unhealthy[replica] = true
+}
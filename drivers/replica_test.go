@@ -0,0 +1,198 @@
+package drivers
+
+import (
+	goerrors "errors"
+	"fmt"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errUnavailable = goerrors.New("unavailable")
+
+type failingDriver struct {
+	Driver
+	fail bool
+}
+
+func (d *failingDriver) Read(path string) (io.ReadCloser, error) {
+	if d.fail {
+		return nil, errUnavailable
+	}
+	return d.Driver.Read(path)
+}
+
+func (d *failingDriver) Write(path string, data []byte) error {
+	if d.fail {
+		return errUnavailable
+	}
+	return d.Driver.Write(path, data)
+}
+
+func (d *failingDriver) Put(path string, data []byte) error {
+	if d.fail {
+		return errUnavailable
+	}
+	return d.Driver.Put(path, data)
+}
+
+func (d *failingDriver) Delete(path string) error {
+	if d.fail {
+		return errUnavailable
+	}
+	return d.Driver.Delete(path)
+}
+
+func (d *failingDriver) Update(path string, data []byte, prepend bool) error {
+	if d.fail {
+		return errUnavailable
+	}
+	return d.Driver.Update(path, data, prepend)
+}
+
+func TestReplicaDriver(t *testing.T) {
+	first := NewMemoryDriver()
+	second := NewMemoryDriver()
+	driver := NewReplicaDriver(ConsistencyAll, first, second)
+
+	// Test Write lands on every replica
+	err := driver.Write("test.txt", []byte("Hello, Replica!"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello, Replica!", readString(t, first, "test.txt"))
+	assert.Equal(t, "Hello, Replica!", readString(t, second, "test.txt"))
+
+	// Test Update lands on every replica
+	err = driver.Update("test.txt", []byte(" Appended"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello, Replica! Appended", readString(t, second, "test.txt"))
+
+	// Test errors shared by all replicas are not divergences
+	err = driver.Write("test.txt", []byte("again"))
+	assert.Equal(t, errors.ErrFileExists, err)
+	assert.Empty(t, driver.Divergences())
+
+	// Test Delete lands on every replica
+	err = driver.Delete("test.txt")
+	assert.NoError(t, err)
+
+	_, err = driver.Read("test.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+	_, err = second.Read("test.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+}
+
+func TestReplicaDriverConsistency(t *testing.T) {
+	healthy := NewMemoryDriver()
+	broken := &failingDriver{Driver: NewMemoryDriver(), fail: true}
+
+	// Test ConsistencyAll fails when one replica fails, leaving the
+	// replica that took the change out of step
+	driver := NewReplicaDriver(ConsistencyAll, healthy, broken)
+	err := driver.Put("test.txt", []byte("test"))
+	assert.Equal(t, errUnavailable, err)
+
+	divergences := driver.Divergences()
+	if assert.Len(t, divergences, 1) {
+		assert.Equal(t, 0, divergences[0].Replica)
+	}
+
+	// Test ConsistencyQuorum succeeds with a majority
+	driver = NewReplicaDriver(ConsistencyQuorum, healthy, NewMemoryDriver(), broken)
+	err = driver.Put("test.txt", []byte("test"))
+	assert.NoError(t, err)
+
+	divergences = driver.Divergences()
+	assert.Len(t, divergences, 1)
+	assert.Equal(t, "test.txt", divergences[0].Path)
+	assert.Equal(t, 2, divergences[0].Replica)
+	assert.Equal(t, "PUT", divergences[0].Operation)
+
+	// Test ConsistencyQuorum fails without a majority
+	driver = NewReplicaDriver(ConsistencyQuorum, healthy, broken, &failingDriver{Driver: NewMemoryDriver(), fail: true})
+	err = driver.Put("test.txt", []byte("test"))
+	assert.Equal(t, errUnavailable, err)
+
+	// Test ConsistencyPrimary only waits for the first replica
+	secondary := &failingDriver{Driver: NewMemoryDriver(), fail: true}
+	driver = NewReplicaDriver(ConsistencyPrimary, healthy, secondary)
+	err = driver.Put("async.txt", []byte("async"))
+	assert.NoError(t, err)
+
+	driver.Wait()
+	assert.Len(t, driver.Divergences(), 1)
+
+	err = NewReplicaDriver(ConsistencyPrimary, broken, healthy).Put("async.txt", []byte("async"))
+	assert.Equal(t, errUnavailable, err)
+}
+
+func TestReplicaDriverReconcile(t *testing.T) {
+	primary := NewMemoryDriver()
+	backup := &failingDriver{Driver: NewMemoryDriver()}
+	driver := NewReplicaDriver(ConsistencyQuorum, primary, NewMemoryDriver(), backup)
+
+	assert.NoError(t, driver.Put("kept.txt", []byte("v1")))
+	assert.NoError(t, driver.Put("deleted.txt", []byte("v1")))
+
+	// Take the backup down while changes happen
+	backup.fail = true
+	assert.NoError(t, driver.Put("kept.txt", []byte("v2")))
+	assert.NoError(t, driver.Update("kept.txt", []byte(" appended"), false))
+	assert.NoError(t, driver.Delete("deleted.txt"))
+	assert.NoError(t, driver.Put("new.txt", []byte("new")))
+	assert.Len(t, driver.Divergences(), 3)
+
+	// Test reads skip the unhealthy replica
+	assert.Equal(t, "v2 appended", readString(t, driver, "kept.txt"))
+
+	// Test Reconcile keeps failures while the backup is down
+	err := driver.Reconcile()
+	assert.Error(t, err)
+	assert.Len(t, driver.Divergences(), 3)
+
+	// Test Reconcile repairs the backup once it is back
+	backup.fail = false
+	err = driver.Reconcile()
+	assert.NoError(t, err)
+	assert.Empty(t, driver.Divergences())
+
+	assert.Equal(t, "v2 appended", readString(t, backup, "kept.txt"))
+	assert.Equal(t, "new", readString(t, backup, "new.txt"))
+
+	_, err = backup.Read("deleted.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+}
+
+func TestReplicaDriverReconcileFailedChange(t *testing.T) {
+	a := NewMemoryDriver()
+	b := NewMemoryDriver()
+	assert.NoError(t, b.Write("x", []byte("old")))
+
+	driver := NewReplicaDriver(ConsistencyAll, a, b)
+
+	// Test the refused change is rolled back by Reconcile, not forced on b
+	err := driver.Write("x", []byte("new"))
+	assert.Equal(t, errors.ErrFileExists, err)
+	assert.Equal(t, "old", readString(t, driver, "x"))
+
+	assert.NoError(t, driver.Reconcile())
+	assert.Equal(t, "old", readString(t, a, "x"))
+	assert.Equal(t, "old", readString(t, b, "x"))
+}
+
+func TestReplicaDriverPrimaryKeepsOrder(t *testing.T) {
+	primary := NewMemoryDriver()
+	secondary := NewMemoryDriver()
+	driver := NewReplicaDriver(ConsistencyPrimary, primary, secondary)
+
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, driver.Put("a.txt", []byte(fmt.Sprint(i))))
+	}
+	assert.NoError(t, driver.Update("a.txt", []byte("!"), false))
+	driver.Wait()
+
+	assert.Equal(t, "49!", readString(t, primary, "a.txt"))
+	assert.Equal(t, "49!", readString(t, secondary, "a.txt"))
+	assert.Empty(t, driver.Divergences())
+}
@@ -0,0 +1,227 @@
+package drivers
+
+import (
+	"bytes"
+	"context"
+	goerrors "errors"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"io/fs"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+)
+
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts including the first one
+	BaseDelay   time.Duration // delay before the first retry, doubled each time
+	MaxDelay    time.Duration // upper bound for a single delay
+	Jitter      float64       // fraction of each delay that is randomized, 0 to 1
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+	Jitter:      0.2,
+}
+
+type RetryOptions struct {
+	// Default applies to operations without their own policy. A zero value
+	// uses DefaultRetryPolicy.
+	Default RetryPolicy
+	// Policies overrides the policy per operation: READ, WRITE, PUT, DELETE
+	// or UPDATE. UPDATE is attempted once unless it has a policy here,
+	// since retrying an append that may have landed would apply it twice.
+	Policies map[string]RetryPolicy
+	// Classifier reports whether an error is worth retrying. Nil uses
+	// IsRetryable.
+	Classifier func(err error) bool
+}
+
+// RetryDriver retries failed operations with exponential backoff when the
+// classifier considers the error transient.
+type RetryDriver struct {
+	driver Driver
+	opts   RetryOptions
+	sleep  func(time.Duration)
+}
+
+func NewRetryDriver(driver Driver, opts RetryOptions) *RetryDriver {
+	if opts.Default.MaxAttempts == 0 {
+		opts.Default = DefaultRetryPolicy
+	}
+
+	if opts.Classifier == nil {
+		opts.Classifier = IsRetryable
+	}
+
+	return &RetryDriver{
+		driver: driver,
+		opts:   opts,
+		sleep:  time.Sleep,
+	}
+}
+
+func (d *RetryDriver) Read(path string) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+
+	err := d.do("READ", func(int) error {
+		var err error
+		reader, err = d.driver.Read(path)
+		return err
+	})
+
+	return reader, err
+}
+
+// Write treats ErrFileExists on a retry as success when the stored content
+// matches, since the failed attempt may have gone through after all.
+func (d *RetryDriver) Write(path string, data []byte) error {
+	return d.do("WRITE", func(attempt int) error {
+		err := d.driver.Write(path, data)
+		if err == errors.ErrFileExists && attempt > 1 && d.holds(path, data) {
+			return nil
+		}
+		return err
+	})
+}
+
+func (d *RetryDriver) Put(path string, data []byte) error {
+	return d.do("PUT", func(int) error {
+		return d.driver.Put(path, data)
+	})
+}
+
+// Delete treats ErrFileNotFound on a retry as success, since the failed
+// attempt may have gone through after all.
+func (d *RetryDriver) Delete(path string) error {
+	return d.do("DELETE", func(attempt int) error {
+		err := d.driver.Delete(path)
+		if err == errors.ErrFileNotFound && attempt > 1 {
+			return nil
+		}
+		return err
+	})
+}
+
+func (d *RetryDriver) Update(path string, data []byte, prepend bool) error {
+	return d.do("UPDATE", func(int) error {
+		return d.driver.Update(path, data, prepend)
+	})
+}
+
+func (d *RetryDriver) List(prefix string) ([]string, error) {
+	var paths []string
+
+	err := d.do("READ", func(int) error {
+		var err error
+		paths, err = listFiles(d.driver, prefix)
+		return err
+	})
+
+	return paths, err
+}
+
+func (d *RetryDriver) do(operation string, attempt func(attempt int) error) error {
+	policy := d.policy(operation)
+
+	var err error
+	for i := 1; ; i++ {
+		err = attempt(i)
+		if err == nil || i >= policy.MaxAttempts || !d.opts.Classifier(err) {
+			return err
+		}
+
+		d.sleep(backoff(policy, i))
+	}
+}
+
+func (d *RetryDriver) policy(operation string) RetryPolicy {
+	if policy, exists := d.opts.Policies[operation]; exists {
+		return policy
+	}
+
+	if operation == "UPDATE" {
+		return RetryPolicy{MaxAttempts: 1}
+	}
+
+	return d.opts.Default
+}
+
+func (d *RetryDriver) holds(path string, data []byte) bool {
+	reader, err := d.driver.Read(path)
+	if err != nil {
+		return false
+	}
+	defer reader.Close()
+
+	stored, err := io.ReadAll(reader)
+	return err == nil && bytes.Equal(stored, data)
+}
+
+func backoff(policy RetryPolicy, attempt int) time.Duration {
+	delay := policy.BaseDelay << (attempt - 1)
+
+	// Shifting back tells whether the doubling overflowed
+	overflowed := delay>>(attempt-1) != policy.BaseDelay
+	if overflowed || (policy.MaxDelay > 0 && delay > policy.MaxDelay) {
+		delay = policy.MaxDelay
+	}
+
+	if policy.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * policy.Jitter * float64(delay))
+	}
+
+	return delay
+}
+
+// IsRetryable is the default retry classifier. Errors that describe the
+// state of a file, like ErrFileNotFound or ErrFileExists, are permanent.
+// Timeouts, network errors and errors the AWS SDK considers retryable
+// (throttling, 5xx responses) are transient, other S3 client errors are
+// permanent. Anything else is retried.
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case goerrors.Is(err, errors.ErrFileNotFound),
+		goerrors.Is(err, errors.ErrFileExists),
+		goerrors.Is(err, errors.ErrPermissionDenied),
+		goerrors.Is(err, errors.ErrQuotaExceeded),
+		goerrors.Is(err, errors.ErrCorruptData),
+		goerrors.Is(err, errors.ErrNotSupported),
+		goerrors.Is(err, errors.ErrNotMounted),
+		goerrors.Is(err, fs.ErrNotExist),
+		goerrors.Is(err, fs.ErrExist),
+		goerrors.Is(err, fs.ErrPermission),
+		goerrors.Is(err, context.Canceled):
+		return false
+	case goerrors.Is(err, context.DeadlineExceeded):
+		return true
+	}
+
+	var netErr net.Error
+	if goerrors.As(err, &netErr) {
+		return true
+	}
+
+	switch retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) {
+	case aws.TrueTernary:
+		return true
+	case aws.FalseTernary:
+		return false
+	}
+
+	// Malformed requests fail the same way every time
+	var apiErr smithy.APIError
+	if goerrors.As(err, &apiErr) && apiErr.ErrorFault() == smithy.FaultClient {
+		return false
+	}
+
+	return true
+}
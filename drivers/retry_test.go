@@ -0,0 +1,179 @@
+package drivers
+
+import (
+	"context"
+	"fmt"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyDriver fails the next failures calls with err. When applied is set
+// the failing call still reaches the wrapped driver, like a request that
+// timed out after the server handled it.
+type flakyDriver struct {
+	Driver
+	failures int
+	err      error
+	applied  bool
+	calls    int
+}
+
+func (d *flakyDriver) fail(call func() error) error {
+	d.calls++
+	if d.failures == 0 {
+		return call()
+	}
+
+	d.failures--
+	if d.applied {
+		call()
+	}
+	return d.err
+}
+
+func (d *flakyDriver) Read(path string) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	err := d.fail(func() error {
+		var err error
+		reader, err = d.Driver.Read(path)
+		return err
+	})
+	return reader, err
+}
+
+func (d *flakyDriver) Write(path string, data []byte) error {
+	return d.fail(func() error { return d.Driver.Write(path, data) })
+}
+
+func (d *flakyDriver) Put(path string, data []byte) error {
+	return d.fail(func() error { return d.Driver.Put(path, data) })
+}
+
+func (d *flakyDriver) Delete(path string) error {
+	return d.fail(func() error { return d.Driver.Delete(path) })
+}
+
+func (d *flakyDriver) Update(path string, data []byte, prepend bool) error {
+	return d.fail(func() error { return d.Driver.Update(path, data, prepend) })
+}
+
+func newTestRetryDriver(driver Driver, opts RetryOptions) (*RetryDriver, *[]time.Duration) {
+	delays := make([]time.Duration, 0)
+
+	retryDriver := NewRetryDriver(driver, opts)
+	retryDriver.sleep = func(delay time.Duration) {
+		delays = append(delays, delay)
+	}
+
+	return retryDriver, &delays
+}
+
+func TestRetryDriver(t *testing.T) {
+	backend := &flakyDriver{Driver: NewMemoryDriver(), err: context.DeadlineExceeded}
+	driver, delays := newTestRetryDriver(backend, RetryOptions{
+		Default: RetryPolicy{MaxAttempts: 4, BaseDelay: 10 * time.Millisecond, MaxDelay: 25 * time.Millisecond},
+	})
+
+	// Test transient failures are retried with exponential backoff
+	backend.failures = 3
+	err := driver.Put("test.txt", []byte("Hello, Retry!"))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, backend.calls)
+	assert.Equal(t, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 25 * time.Millisecond}, *delays)
+
+	backend.failures = 1
+	assert.Equal(t, "Hello, Retry!", readString(t, driver, "test.txt"))
+
+	// Test giving up after MaxAttempts
+	backend.calls = 0
+	backend.failures = 10
+	err = driver.Put("test.txt", []byte("test"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 4, backend.calls)
+
+	// Test permanent errors are not retried
+	backend.calls = 0
+	backend.failures = 0
+	_, err = driver.Read("missing.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+	assert.Equal(t, 1, backend.calls)
+
+	// Test Update is attempted once by default
+	backend.calls = 0
+	backend.failures = 1
+	err = driver.Update("test.txt", []byte("!"), false)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, backend.calls)
+}
+
+func TestRetryDriverAmbiguousFailures(t *testing.T) {
+	backend := &flakyDriver{Driver: NewMemoryDriver(), err: context.DeadlineExceeded, applied: true}
+	driver, _ := newTestRetryDriver(backend, RetryOptions{
+		Policies: map[string]RetryPolicy{"UPDATE": {MaxAttempts: 2}},
+	})
+
+	// Test a Write that landed before timing out
+	backend.failures = 1
+	err := driver.Write("test.txt", []byte("data"))
+	assert.NoError(t, err)
+
+	// Test a Write that collides with someone else's file
+	backend.failures = 1
+	assert.NoError(t, backend.Driver.Put("other.txt", []byte("theirs")))
+	err = driver.Write("other.txt", []byte("mine"))
+	assert.Equal(t, errors.ErrFileExists, err)
+
+	// Test a Delete that landed before timing out
+	backend.failures = 1
+	err = driver.Delete("test.txt")
+	assert.NoError(t, err)
+
+	// Test an opted-in Update retry applies twice when the first one landed
+	assert.NoError(t, backend.Driver.Put("log.txt", []byte("a")))
+	backend.failures = 1
+	err = driver.Update("log.txt", []byte("b"), false)
+	assert.NoError(t, err)
+	assert.Equal(t, "abb", readString(t, backend.Driver, "log.txt"))
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.False(t, IsRetryable(nil))
+	assert.False(t, IsRetryable(errors.ErrFileNotFound))
+	assert.False(t, IsRetryable(errors.ErrFileExists))
+	assert.False(t, IsRetryable(errors.ErrPermissionDenied))
+	assert.False(t, IsRetryable(fmt.Errorf("wrapped: %w", errors.ErrFileNotFound)))
+	assert.False(t, IsRetryable(&errors.QuotaError{}))
+	assert.False(t, IsRetryable(context.Canceled))
+	assert.False(t, IsRetryable(&smithy.GenericAPIError{Code: "InvalidBucketName", Fault: smithy.FaultClient}))
+
+	assert.True(t, IsRetryable(context.DeadlineExceeded))
+	assert.True(t, IsRetryable(&smithy.GenericAPIError{Code: "SlowDown", Fault: smithy.FaultServer}))
+	assert.True(t, IsRetryable(&smithy.GenericAPIError{Code: "InternalError", Fault: smithy.FaultServer}))
+	assert.True(t, IsRetryable(fmt.Errorf("connection reset")))
+}
+
+func TestBackoffJitter(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, Jitter: 0.5}
+
+	for i := 0; i < 20; i++ {
+		delay := backoff(policy, 2)
+		assert.GreaterOrEqual(t, delay, 100*time.Millisecond)
+		assert.LessOrEqual(t, delay, 200*time.Millisecond)
+	}
+}
+
+func TestBackoffLimits(t *testing.T) {
+	// Test a zero base delay retries right away
+	assert.Equal(t, time.Duration(0), backoff(RetryPolicy{MaxDelay: time.Second}, 3))
+
+	// Test the delay is capped, also when doubling overflows
+	policy := RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Minute}
+	assert.Equal(t, 4*time.Second, backoff(policy, 3))
+	assert.Equal(t, time.Minute, backoff(policy, 10))
+	assert.Equal(t, time.Minute, backoff(policy, 70))
+}
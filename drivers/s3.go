@@ -3,23 +3,33 @@ package drivers
 import (
 	"bytes"
 	"context"
+	goerrors "errors"
 	"github.com/vanvanni/lampofs/errors"
 	"io"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type S3Driver struct {
 	client     *s3.Client
 	bucketName string
+	prefix     string
 }
 
 type S3Options struct {
 	Region     string
 	BucketName string
 	Endpoint   string
+	Prefix     string
+	// TracerProvider receives a span for every S3 API call. Nil uses the
+	// global provider.
+	TracerProvider trace.TracerProvider
 }
 
 func NewS3Driver(opts S3Options) (*S3Driver, error) {
@@ -28,6 +38,12 @@ func NewS3Driver(opts S3Options) (*S3Driver, error) {
 		return nil, err
 	}
 
+	provider := opts.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	cfg.APIOptions = append(cfg.APIOptions, tracingMiddleware(provider))
+
 	client := s3.NewFromConfig(cfg)
 
 	if opts.Endpoint != "" {
@@ -43,20 +59,19 @@ func NewS3Driver(opts S3Options) (*S3Driver, error) {
 	return &S3Driver{
 		client:     client,
 		bucketName: opts.BucketName,
+		prefix:     strings.Trim(opts.Prefix, "/"),
 	}, nil
 }
 
 func (d *S3Driver) Read(path string) (io.ReadCloser, error) {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(d.bucketName),
-		Key:    aws.String(path),
+		Key:    aws.String(d.key(path)),
 	}
 
 	result, err := d.client.GetObject(context.TODO(), input)
 	if err != nil {
-		// Check if it's a "not found" error
-		// In a real implementation, you'd check the specific error type
-		return nil, errors.ErrFileNotFound
+		return nil, s3Error(err)
 	}
 
 	return result.Body, nil
@@ -65,16 +80,21 @@ func (d *S3Driver) Read(path string) (io.ReadCloser, error) {
 func (d *S3Driver) Write(path string, data []byte) error {
 	_, err := d.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
 		Bucket: aws.String(d.bucketName),
-		Key:    aws.String(path),
+		Key:    aws.String(d.key(path)),
 	})
 
 	if err == nil {
 		return errors.ErrFileExists
 	}
 
+	// Without s3:ListBucket a missing key is reported as forbidden
+	if err = s3Error(err); err != errors.ErrFileNotFound && err != errors.ErrPermissionDenied {
+		return err
+	}
+
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(d.bucketName),
-		Key:    aws.String(path),
+		Key:    aws.String(d.key(path)),
 		Body:   bytes.NewReader(data),
 	}
 
@@ -85,7 +105,7 @@ func (d *S3Driver) Write(path string, data []byte) error {
 func (d *S3Driver) Put(path string, data []byte) error {
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(d.bucketName),
-		Key:    aws.String(path),
+		Key:    aws.String(d.key(path)),
 		Body:   bytes.NewReader(data),
 	}
 
@@ -96,16 +116,16 @@ func (d *S3Driver) Put(path string, data []byte) error {
 func (d *S3Driver) Delete(path string) error {
 	_, err := d.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
 		Bucket: aws.String(d.bucketName),
-		Key:    aws.String(path),
+		Key:    aws.String(d.key(path)),
 	})
 
 	if err != nil {
-		return errors.ErrFileNotFound
+		return s3Error(err)
 	}
 
 	input := &s3.DeleteObjectInput{
 		Bucket: aws.String(d.bucketName),
-		Key:    aws.String(path),
+		Key:    aws.String(d.key(path)),
 	}
 
 	_, err = d.client.DeleteObject(context.TODO(), input)
@@ -117,7 +137,7 @@ func (d *S3Driver) Update(path string, data []byte, prepend bool) error {
 
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(d.bucketName),
-		Key:    aws.String(path),
+		Key:    aws.String(d.key(path)),
 	}
 
 	result, err := d.client.GetObject(context.TODO(), input)
@@ -127,23 +147,122 @@ func (d *S3Driver) Update(path string, data []byte, prepend bool) error {
 		if err != nil {
 			return err
 		}
+	} else if err = s3Error(err); err != errors.ErrFileNotFound {
+		return err
 	}
 
-	var newData []byte
-	if prepend {
-		newData = make([]byte, len(data)+len(existingData))
-		copy(newData, data)
-		copy(newData[len(data):], existingData)
-	} else {
-		newData = append(existingData, data...)
-	}
+	newData := applyUpdate(existingData, data, prepend)
 
 	putInput := &s3.PutObjectInput{
 		Bucket: aws.String(d.bucketName),
-		Key:    aws.String(path),
+		Key:    aws.String(d.key(path)),
 		Body:   bytes.NewReader(newData),
 	}
 
 	_, err = d.client.PutObject(context.TODO(), putInput)
 	return err
 }
+
+func (d *S3Driver) List(prefix string) ([]string, error) {
+	keyPrefix := d.key(prefix)
+	paths := make([]string, 0)
+
+	paginator := s3.NewListObjectsV2Paginator(d.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(d.bucketName),
+		Prefix: aws.String(keyPrefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if d.prefix != "" {
+				key = strings.TrimPrefix(key, d.prefix+"/")
+			}
+			paths = append(paths, key)
+		}
+	}
+
+	return paths, nil
+}
+
+func (d *S3Driver) ListVersions(path string) ([]Version, error) {
+	key := d.key(path)
+	versions := make([]Version, 0)
+
+	paginator := s3.NewListObjectVersionsPaginator(d.client, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(d.bucketName),
+		Prefix: aws.String(key),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, version := range page.Versions {
+			// Skip the current object and other keys sharing the prefix
+			if aws.ToString(version.Key) != key || aws.ToBool(version.IsLatest) {
+				continue
+			}
+
+			versions = append(versions, Version{
+				ID:        aws.ToString(version.VersionId),
+				Timestamp: aws.ToTime(version.LastModified),
+			})
+		}
+	}
+
+	return versions, nil
+}
+
+func (d *S3Driver) ReadVersion(path, id string) (io.ReadCloser, error) {
+	result, err := d.client.GetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket:    aws.String(d.bucketName),
+		Key:       aws.String(d.key(path)),
+		VersionId: aws.String(id),
+	})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+
+	return result.Body, nil
+}
+
+func (d *S3Driver) DeleteVersion(path, id string) error {
+	_, err := d.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket:    aws.String(d.bucketName),
+		Key:       aws.String(d.key(path)),
+		VersionId: aws.String(id),
+	})
+	return err
+}
+
+func (d *S3Driver) key(path string) string {
+	if d.prefix == "" {
+		return path
+	}
+
+	return d.prefix + "/" + strings.TrimPrefix(path, "/")
+}
+
+// s3Error maps missing keys to ErrFileNotFound and passes everything else
+// through, so transient failures are not mistaken for missing files.
+func s3Error(err error) error {
+	var apiErr smithy.APIError
+	if goerrors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound", "NoSuchVersion":
+			return errors.ErrFileNotFound
+		case "AccessDenied", "Forbidden":
+			return errors.ErrPermissionDenied
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,184 @@
+package drivers
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+type ThrottleLimit struct {
+	Prefix         string             // whole path segments, "" applies to every path
+	OpsPerSecond   float64            // all operations combined, 0 for no limit
+	Operations     map[string]float64 // ops per second for READ, WRITE, PUT, DELETE or UPDATE
+	BytesPerSecond int64              // bytes read and written combined, 0 for no limit
+}
+
+type ThrottleOptions struct {
+	Limits []ThrottleLimit
+}
+
+// ThrottleDriver delays operations so they stay within the configured
+// rates. Every limit whose prefix covers a path applies, so "bulk" limits
+// "bulk/a" but not "bulkhead/a". Read streams are throttled as they are
+// consumed, write payloads before they are sent.
+type ThrottleDriver struct {
+	driver Driver
+	limits []*throttleLimit
+	now    func() time.Time
+	sleep  func(time.Duration)
+}
+
+type throttleLimit struct {
+	prefix     string
+	ops        *tokenBucket
+	operations map[string]*tokenBucket
+	bytes      *tokenBucket
+}
+
+func NewThrottleDriver(driver Driver, opts ThrottleOptions) *ThrottleDriver {
+	d := &ThrottleDriver{
+		driver: driver,
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+
+	for _, limit := range opts.Limits {
+		l := &throttleLimit{
+			prefix:     limit.Prefix,
+			ops:        newTokenBucket(limit.OpsPerSecond, max(1, limit.OpsPerSecond)),
+			operations: make(map[string]*tokenBucket, len(limit.Operations)),
+			bytes:      newTokenBucket(float64(limit.BytesPerSecond), float64(limit.BytesPerSecond)),
+		}
+
+		for operation, rate := range limit.Operations {
+			l.operations[operation] = newTokenBucket(rate, max(1, rate))
+		}
+
+		d.limits = append(d.limits, l)
+	}
+
+	return d
+}
+
+func (d *ThrottleDriver) Read(path string) (io.ReadCloser, error) {
+	d.wait(path, "READ", 0)
+
+	reader, err := d.driver.Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &throttledReader{
+		ReadCloser: reader,
+		driver:     d,
+		path:       path,
+	}, nil
+}
+
+func (d *ThrottleDriver) Write(path string, data []byte) error {
+	d.wait(path, "WRITE", len(data))
+	return d.driver.Write(path, data)
+}
+
+func (d *ThrottleDriver) Put(path string, data []byte) error {
+	d.wait(path, "PUT", len(data))
+	return d.driver.Put(path, data)
+}
+
+func (d *ThrottleDriver) Delete(path string) error {
+	d.wait(path, "DELETE", 0)
+	return d.driver.Delete(path)
+}
+
+func (d *ThrottleDriver) Update(path string, data []byte, prepend bool) error {
+	d.wait(path, "UPDATE", len(data))
+	return d.driver.Update(path, data, prepend)
+}
+
+func (d *ThrottleDriver) List(prefix string) ([]string, error) {
+	d.wait(prefix, "READ", 0)
+	return listFiles(d.driver, prefix)
+}
+
+// wait takes one operation and n bytes from every matching limit and
+// sleeps until the slowest of them allows it. An empty operation only
+// takes bytes.
+func (d *ThrottleDriver) wait(path, operation string, n int) {
+	now := d.now()
+
+	var delay time.Duration
+	for _, limit := range d.limits {
+		if !quotaCovers(limit.prefix, path) {
+			continue
+		}
+
+		if operation != "" {
+			delay = max(delay, limit.ops.reserve(now, 1))
+			if bucket, exists := limit.operations[operation]; exists {
+				delay = max(delay, bucket.reserve(now, 1))
+			}
+		}
+
+		if n > 0 {
+			delay = max(delay, limit.bytes.reserve(now, float64(n)))
+		}
+	}
+
+	if delay > 0 {
+		d.sleep(delay)
+	}
+}
+
+type throttledReader struct {
+	io.ReadCloser
+	driver *ThrottleDriver
+	path   string
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.driver.wait(r.path, "", n)
+	return n, err
+}
+
+// tokenBucket refills at rate tokens per second up to burst. Reservations
+// may take it below zero, later callers then wait for the debt to be
+// paid off.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+	}
+}
+
+// reserve takes n tokens and returns how long the caller has to wait for
+// them. A bucket without a rate never blocks.
+func (b *tokenBucket) reserve(now time.Time, n float64) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if now.After(b.last) {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
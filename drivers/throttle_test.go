@@ -0,0 +1,99 @@
+package drivers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestThrottleDriver runs on a fake clock that sleeping advances. The
+// returned pointer holds the total time slept.
+func newTestThrottleDriver(driver Driver, opts ThrottleOptions) (*ThrottleDriver, *time.Duration) {
+	clock := time.Unix(0, 0)
+	slept := new(time.Duration)
+
+	throttle := NewThrottleDriver(driver, opts)
+	throttle.now = func() time.Time { return clock }
+	throttle.sleep = func(delay time.Duration) {
+		*slept += delay
+		clock = clock.Add(delay)
+	}
+
+	return throttle, slept
+}
+
+func TestThrottleDriverOpsPerSecond(t *testing.T) {
+	throttle, slept := newTestThrottleDriver(NewMemoryDriver(), ThrottleOptions{
+		Limits: []ThrottleLimit{{OpsPerSecond: 2}},
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, throttle.Put("a.txt", []byte("a")))
+	}
+
+	// The first two fit the burst, the other four wait half a second each
+	assert.Equal(t, 2*time.Second, *slept)
+}
+
+func TestThrottleDriverPerOperation(t *testing.T) {
+	throttle, slept := newTestThrottleDriver(NewMemoryDriver(), ThrottleOptions{
+		Limits: []ThrottleLimit{{Operations: map[string]float64{"DELETE": 1}}},
+	})
+
+	for i := 0; i < 3; i++ {
+		throttle.Put("a.txt", []byte("a"))
+	}
+	assert.Zero(t, *slept)
+
+	throttle.Delete("a.txt")
+	throttle.Delete("a.txt")
+	assert.Equal(t, time.Second, *slept)
+}
+
+func TestThrottleDriverBytesPerSecond(t *testing.T) {
+	memory := NewMemoryDriver()
+	memory.Put("big.bin", []byte(strings.Repeat("x", 300)))
+
+	throttle, slept := newTestThrottleDriver(memory, ThrottleOptions{
+		Limits: []ThrottleLimit{{BytesPerSecond: 100}},
+	})
+
+	assert.Equal(t, 300, len(readString(t, throttle, "big.bin")))
+	assert.Equal(t, 2*time.Second, *slept)
+
+	assert.NoError(t, throttle.Put("copy.bin", []byte(strings.Repeat("x", 100))))
+	assert.Equal(t, 3*time.Second, *slept)
+}
+
+func TestThrottleDriverPrefix(t *testing.T) {
+	throttle, slept := newTestThrottleDriver(NewMemoryDriver(), ThrottleOptions{
+		Limits: []ThrottleLimit{{Prefix: "bulk/", OpsPerSecond: 1}},
+	})
+
+	for i := 0; i < 3; i++ {
+		throttle.Put("app/a.txt", []byte("a"))
+	}
+	assert.Zero(t, *slept)
+
+	throttle.Put("bulk/a.txt", []byte("a"))
+	throttle.Put("bulk/b.txt", []byte("b"))
+	assert.Equal(t, time.Second, *slept)
+}
+
+func TestThrottleDriverPrefixBoundaries(t *testing.T) {
+	throttle, slept := newTestThrottleDriver(NewMemoryDriver(), ThrottleOptions{
+		Limits: []ThrottleLimit{{Prefix: "bulk", OpsPerSecond: 1}},
+	})
+
+	// Test a sibling sharing the name prefix is not throttled
+	for i := 0; i < 3; i++ {
+		throttle.Put("bulkhead/a.txt", []byte("a"))
+	}
+	assert.Zero(t, *slept)
+
+	throttle.Put("/bulk/a.txt", []byte("a"))
+	throttle.Put("bulk/b.txt", []byte("b"))
+	assert.Equal(t, time.Second, *slept)
+}
@@ -0,0 +1,176 @@
+package drivers
+
+import (
+	"context"
+	"io"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/vanvanni/lampofs/drivers"
+
+type TracingOptions struct {
+	Name           string               // recorded as lampofs.driver
+	TracerProvider trace.TracerProvider // nil uses the global provider
+}
+
+// TracingDriver wraps every operation in an OpenTelemetry span. Operations
+// do not take a context yet, so spans start new traces instead of joining
+// the caller's.
+type TracingDriver struct {
+	driver Driver
+	name   string
+	tracer trace.Tracer
+}
+
+func NewTracingDriver(driver Driver, opts TracingOptions) *TracingDriver {
+	provider := opts.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	return &TracingDriver{
+		driver: driver,
+		name:   opts.Name,
+		tracer: provider.Tracer(tracerName),
+	}
+}
+
+func (d *TracingDriver) Read(path string) (io.ReadCloser, error) {
+	span := d.start("Read", path)
+	reader, err := d.driver.Read(path)
+	endSpan(span, err)
+
+	return reader, err
+}
+
+func (d *TracingDriver) Write(path string, data []byte) error {
+	span := d.start("Write", path, attribute.Int("lampofs.bytes", len(data)))
+	err := d.driver.Write(path, data)
+	endSpan(span, err)
+
+	return err
+}
+
+func (d *TracingDriver) Put(path string, data []byte) error {
+	span := d.start("Put", path, attribute.Int("lampofs.bytes", len(data)))
+	err := d.driver.Put(path, data)
+	endSpan(span, err)
+
+	return err
+}
+
+func (d *TracingDriver) Delete(path string) error {
+	span := d.start("Delete", path)
+	err := d.driver.Delete(path)
+	endSpan(span, err)
+
+	return err
+}
+
+func (d *TracingDriver) Update(path string, data []byte, prepend bool) error {
+	span := d.start("Update", path,
+		attribute.Int("lampofs.bytes", len(data)),
+		attribute.Bool("lampofs.prepend", prepend),
+	)
+	err := d.driver.Update(path, data, prepend)
+	endSpan(span, err)
+
+	return err
+}
+
+func (d *TracingDriver) List(prefix string) ([]string, error) {
+	span := d.start("List", prefix)
+	paths, err := listFiles(d.driver, prefix)
+	endSpan(span, err)
+
+	return paths, err
+}
+
+func (d *TracingDriver) start(operation, path string, attributes ...attribute.KeyValue) trace.Span {
+	attributes = append(attributes,
+		attribute.String("lampofs.driver", d.name),
+		attribute.String("lampofs.path", path),
+	)
+
+	_, span := d.tracer.Start(context.Background(), "driver."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+
+	return span
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// tracingMiddleware starts a span around every AWS API call, retries
+// included.
+func tracingMiddleware(provider trace.TracerProvider) func(*middleware.Stack) error {
+	tracer := provider.Tracer(tracerName)
+
+	return func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("LampofsTracing", func(
+			ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+		) (middleware.InitializeOutput, middleware.Metadata, error) {
+			service := awsmiddleware.GetServiceID(ctx)
+			operation := awsmiddleware.GetOperationName(ctx)
+
+			attributes := []attribute.KeyValue{
+				attribute.String("rpc.system", "aws-api"),
+				attribute.String("rpc.service", service),
+				attribute.String("rpc.method", operation),
+			}
+			if key := s3Key(in.Parameters); key != "" {
+				attributes = append(attributes, attribute.String("lampofs.path", key))
+			}
+
+			ctx, span := tracer.Start(ctx, service+"."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attributes...),
+			)
+
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			endSpan(span, err)
+
+			return out, metadata, err
+		}), middleware.After)
+	}
+}
+
+func s3Key(params interface{}) string {
+	var key *string
+
+	switch input := params.(type) {
+	case *s3.GetObjectInput:
+		key = input.Key
+	case *s3.PutObjectInput:
+		key = input.Key
+	case *s3.HeadObjectInput:
+		key = input.Key
+	case *s3.DeleteObjectInput:
+		key = input.Key
+	case *s3.ListObjectsV2Input:
+		key = input.Prefix
+	case *s3.ListObjectVersionsInput:
+		key = input.Prefix
+	}
+
+	if key == nil {
+		return ""
+	}
+
+	return *key
+}
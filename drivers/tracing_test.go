@@ -0,0 +1,74 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracerProvider() (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	return sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), recorder
+}
+
+func TestTracingDriver(t *testing.T) {
+	provider, recorder := newTestTracerProvider()
+	driver := NewTracingDriver(NewMemoryDriver(), TracingOptions{Name: "memory", TracerProvider: provider})
+
+	assert.NoError(t, driver.Put("a.txt", []byte("hello")))
+	assert.Equal(t, errors.ErrFileNotFound, driver.Delete("missing.txt"))
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+
+	assert.Equal(t, "driver.Put", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), attribute.String("lampofs.driver", "memory"))
+	assert.Contains(t, spans[0].Attributes(), attribute.String("lampofs.path", "a.txt"))
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("lampofs.bytes", 5))
+
+	assert.Equal(t, "driver.Delete", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Len(t, spans[1].Events(), 1)
+}
+
+func TestS3DriverTracing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	provider, recorder := newTestTracerProvider()
+	driver := &S3Driver{
+		client: s3.New(s3.Options{
+			Region:       "us-east-1",
+			BaseEndpoint: aws.String(server.URL),
+			UsePathStyle: true,
+			Credentials:  aws.AnonymousCredentials{},
+			APIOptions:   []func(*middleware.Stack) error{tracingMiddleware(provider)},
+		}),
+		bucketName: "bucket",
+	}
+
+	assert.NoError(t, driver.Put("a.txt", []byte("hello")))
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 1) {
+		return
+	}
+
+	assert.Equal(t, "S3.PutObject", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), attribute.String("rpc.method", "PutObject"))
+	assert.Contains(t, spans[0].Attributes(), attribute.String("lampofs.path", "a.txt"))
+}
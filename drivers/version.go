@@ -0,0 +1,253 @@
+package drivers
+
+import (
+	"fmt"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const versionsDir = ".versions"
+
+type Version struct {
+	ID        string
+	Timestamp time.Time
+}
+
+// NativeVersioner is implemented by drivers whose backend keeps object
+// history itself, like S3 buckets with versioning enabled.
+type NativeVersioner interface {
+	ListVersions(path string) ([]Version, error)
+	ReadVersion(path, id string) (io.ReadCloser, error)
+	DeleteVersion(path, id string) error
+}
+
+type VersionOptions struct {
+	// Native hands history to the driver when it implements NativeVersioner
+	// instead of copying old contents into the versions namespace.
+	Native bool
+}
+
+type PruneOptions struct {
+	Keep   int           // newest versions always kept, 0 for no limit
+	MaxAge time.Duration // versions older than this are removed, 0 for no limit
+}
+
+// VersionDriver keeps the previous content of a file whenever Put, Update
+// or Delete would destroy it. Old contents are stored in the wrapped driver
+// under .versions/<path>/<id> and hidden from List.
+type VersionDriver struct {
+	driver Driver
+	native NativeVersioner
+	last   int64
+	mutex  sync.Mutex
+}
+
+func NewVersionDriver(driver Driver, opts VersionOptions) *VersionDriver {
+	d := &VersionDriver{
+		driver: driver,
+	}
+
+	if native, ok := driver.(NativeVersioner); ok && opts.Native {
+		d.native = native
+	}
+
+	return d
+}
+
+func (d *VersionDriver) Read(path string) (io.ReadCloser, error) {
+	return d.driver.Read(path)
+}
+
+func (d *VersionDriver) Write(path string, data []byte) error {
+	if isVersionPath(path) {
+		return errors.ErrPermissionDenied
+	}
+
+	return d.driver.Write(path, data)
+}
+
+func (d *VersionDriver) Put(path string, data []byte) error {
+	if err := d.preserve(path); err != nil && err != errors.ErrFileNotFound {
+		return err
+	}
+
+	return d.driver.Put(path, data)
+}
+
+func (d *VersionDriver) Delete(path string) error {
+	if err := d.preserve(path); err != nil {
+		return err
+	}
+
+	return d.driver.Delete(path)
+}
+
+func (d *VersionDriver) Update(path string, data []byte, prepend bool) error {
+	if err := d.preserve(path); err != nil && err != errors.ErrFileNotFound {
+		return err
+	}
+
+	return d.driver.Update(path, data, prepend)
+}
+
+func (d *VersionDriver) List(prefix string) ([]string, error) {
+	paths, err := listFiles(d.driver, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if !isVersionPath(path) {
+			visible = append(visible, path)
+		}
+	}
+
+	return visible, nil
+}
+
+// ListVersions returns the stored versions of path, newest first.
+func (d *VersionDriver) ListVersions(path string) ([]Version, error) {
+	if d.native != nil {
+		return d.native.ListVersions(path)
+	}
+
+	dir := versionDir(path)
+
+	paths, err := listFiles(d.driver, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]Version, 0, len(paths))
+	for _, versionPath := range paths {
+		id := strings.TrimPrefix(versionPath, dir)
+		if strings.Contains(id, "/") {
+			// A version of a file nested below path
+			continue
+		}
+
+		nanos, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		versions = append(versions, Version{
+			ID:        id,
+			Timestamp: time.Unix(0, nanos),
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].ID > versions[j].ID
+	})
+
+	return versions, nil
+}
+
+func (d *VersionDriver) ReadVersion(path, id string) (io.ReadCloser, error) {
+	if d.native != nil {
+		return d.native.ReadVersion(path, id)
+	}
+
+	return d.driver.Read(versionDir(path) + id)
+}
+
+// Restore makes version id the current content of path. The content it
+// replaces becomes a version itself.
+func (d *VersionDriver) Restore(path, id string) error {
+	reader, err := d.ReadVersion(path, id)
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	return d.Put(path, data)
+}
+
+func (d *VersionDriver) Prune(path string, opts PruneOptions) error {
+	versions, err := d.ListVersions(path)
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-opts.MaxAge)
+
+	for i, version := range versions {
+		tooMany := opts.Keep > 0 && i >= opts.Keep
+		tooOld := opts.MaxAge > 0 && version.Timestamp.Before(cutoff)
+
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		if d.native != nil {
+			err = d.native.DeleteVersion(path, version.ID)
+		} else {
+			err = d.driver.Delete(versionDir(path) + version.ID)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *VersionDriver) preserve(path string) error {
+	if isVersionPath(path) {
+		return errors.ErrPermissionDenied
+	}
+
+	// The backend already keeps the history
+	if d.native != nil {
+		return nil
+	}
+
+	reader, err := d.driver.Read(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Write(versionDir(path)+d.nextID(), data)
+}
+
+// nextID returns a sortable, strictly increasing id based on the clock.
+func (d *VersionDriver) nextID() string {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	now := time.Now().UnixNano()
+	if now <= d.last {
+		now = d.last + 1
+	}
+	d.last = now
+
+	return fmt.Sprintf("%019d", now)
+}
+
+func versionDir(path string) string {
+	return versionsDir + "/" + strings.TrimPrefix(path, "/") + "/"
+}
+
+func isVersionPath(path string) bool {
+	path = strings.TrimPrefix(path, "/")
+	return path == versionsDir || strings.HasPrefix(path, versionsDir+"/")
+}
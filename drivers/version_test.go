@@ -0,0 +1,168 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nativeVersionDriver struct {
+	*MemoryDriver
+	deleted []string
+}
+
+func (d *nativeVersionDriver) ListVersions(path string) ([]Version, error) {
+	return []Version{{ID: "v2"}, {ID: "v1"}}, nil
+}
+
+func (d *nativeVersionDriver) ReadVersion(path, id string) (io.ReadCloser, error) {
+	return d.Read(path + "@" + id)
+}
+
+func (d *nativeVersionDriver) DeleteVersion(path, id string) error {
+	d.deleted = append(d.deleted, id)
+	return nil
+}
+
+func TestVersionDriver(t *testing.T) {
+	backend := NewMemoryDriver()
+	driver := NewVersionDriver(backend, VersionOptions{})
+
+	// Test Write keeps no history for new files
+	err := driver.Write("test.txt", []byte("v1"))
+	assert.NoError(t, err)
+
+	versions, err := driver.ListVersions("test.txt")
+	assert.NoError(t, err)
+	assert.Empty(t, versions)
+
+	// Test Put and Update preserve the previous content
+	assert.NoError(t, driver.Put("test.txt", []byte("v2")))
+	assert.NoError(t, driver.Update("test.txt", []byte(" appended"), false))
+	assert.Equal(t, "v2 appended", readString(t, driver, "test.txt"))
+
+	versions, err = driver.ListVersions("test.txt")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+
+	reader, err := driver.ReadVersion("test.txt", versions[0].ID)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+
+	reader, err = driver.ReadVersion("test.txt", versions[1].ID)
+	assert.NoError(t, err)
+	data, err = io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(data))
+
+	// Test Restore brings back an old version and keeps the replaced one
+	assert.NoError(t, driver.Restore("test.txt", versions[1].ID))
+	assert.Equal(t, "v1", readString(t, driver, "test.txt"))
+
+	versions, err = driver.ListVersions("test.txt")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 3)
+
+	// Test Delete keeps the last content
+	assert.NoError(t, driver.Delete("test.txt"))
+
+	_, err = driver.Read("test.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+
+	versions, err = driver.ListVersions("test.txt")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 4)
+
+	assert.NoError(t, driver.Restore("test.txt", versions[0].ID))
+	assert.Equal(t, "v1", readString(t, driver, "test.txt"))
+
+	// Test the versions namespace is hidden and protected
+	paths, err := driver.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test.txt"}, paths)
+
+	assert.Equal(t, errors.ErrPermissionDenied, driver.Put(".versions/test.txt/1", []byte("forged")))
+
+	// Test Delete of a missing file
+	assert.Equal(t, errors.ErrFileNotFound, driver.Delete("missing.txt"))
+}
+
+func TestVersionDriverPrune(t *testing.T) {
+	backend := NewMemoryDriver()
+	driver := NewVersionDriver(backend, VersionOptions{})
+
+	for _, content := range []string{"v1", "v2", "v3", "v4", "v5"} {
+		assert.NoError(t, driver.Put("test.txt", []byte(content)))
+	}
+
+	// Test nested files keep their own history
+	assert.NoError(t, driver.Put("test.txt/nested", []byte("n1")))
+	assert.NoError(t, driver.Put("test.txt/nested", []byte("n2")))
+
+	versions, err := driver.ListVersions("test.txt")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 4)
+
+	// Test Prune by count keeps the newest
+	assert.NoError(t, driver.Prune("test.txt", PruneOptions{Keep: 2}))
+
+	versions, err = driver.ListVersions("test.txt")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+
+	reader, err := driver.ReadVersion("test.txt", versions[0].ID)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, "v4", string(data))
+
+	// Test Prune by age
+	assert.NoError(t, driver.Prune("test.txt", PruneOptions{MaxAge: time.Hour}))
+
+	versions, err = driver.ListVersions("test.txt")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 2)
+
+	time.Sleep(time.Millisecond)
+	assert.NoError(t, driver.Prune("test.txt", PruneOptions{MaxAge: time.Millisecond}))
+
+	versions, err = driver.ListVersions("test.txt")
+	assert.NoError(t, err)
+	assert.Empty(t, versions)
+
+	versions, err = driver.ListVersions("test.txt/nested")
+	assert.NoError(t, err)
+	assert.Len(t, versions, 1)
+}
+
+func TestVersionDriverNative(t *testing.T) {
+	backend := &nativeVersionDriver{MemoryDriver: NewMemoryDriver()}
+	driver := NewVersionDriver(backend, VersionOptions{Native: true})
+
+	// Test no copies are made when the backend keeps history
+	assert.NoError(t, driver.Put("test.txt", []byte("v1")))
+	assert.NoError(t, driver.Put("test.txt", []byte("v2")))
+
+	paths, err := backend.List("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test.txt"}, paths)
+
+	// Test version calls are delegated
+	versions, err := driver.ListVersions("test.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, []Version{{ID: "v2"}, {ID: "v1"}}, versions)
+
+	assert.NoError(t, backend.Put("test.txt@v1", []byte("v1")))
+	assert.NoError(t, driver.Restore("test.txt", "v1"))
+	assert.Equal(t, "v1", readString(t, driver, "test.txt"))
+
+	assert.NoError(t, driver.Prune("test.txt", PruneOptions{Keep: 1}))
+	assert.Equal(t, []string{"v1"}, backend.deleted)
+}
@@ -0,0 +1,227 @@
+package drivers
+
+import (
+	"encoding/json"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const retentionDir = ".retention"
+
+type WORMOptions struct {
+	// Retention is how long a file stays locked after it is written, 0
+	// locks it for good.
+	Retention time.Duration
+}
+
+type retentionRecord struct {
+	RetainUntil time.Time `json:"retain_until"` // zero for no end
+}
+
+// WORMDriver makes files write once, read many. A file can be created once
+// and is then locked: Put, Update and Delete fail with
+// ErrPermissionDenied until its retention period ends, like an S3 Object
+// Lock in compliance mode. Retention dates are kept under .retention/ in
+// the wrapped driver. Files without a retention record, such as ones that
+// existed before the wrapper, stay locked for good.
+type WORMDriver struct {
+	driver Driver
+	opts   WORMOptions
+	now    func() time.Time
+	mutex  sync.Mutex
+}
+
+func NewWORMDriver(driver Driver, opts WORMOptions) *WORMDriver {
+	return &WORMDriver{
+		driver: driver,
+		opts:   opts,
+		now:    time.Now,
+	}
+}
+
+func (d *WORMDriver) Read(path string) (io.ReadCloser, error) {
+	if isRetentionPath(path) {
+		return nil, errors.ErrPermissionDenied
+	}
+
+	return d.driver.Read(path)
+}
+
+func (d *WORMDriver) Write(path string, data []byte) error {
+	return d.change(path, func() error {
+		return d.driver.Write(path, data)
+	})
+}
+
+func (d *WORMDriver) Put(path string, data []byte) error {
+	return d.change(path, func() error {
+		return d.driver.Put(path, data)
+	})
+}
+
+func (d *WORMDriver) Delete(path string) error {
+	if isRetentionPath(path) {
+		return errors.ErrPermissionDenied
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkUnlocked(path); err != nil {
+		return err
+	}
+
+	if err := d.driver.Delete(path); err != nil {
+		return err
+	}
+
+	err := d.driver.Delete(retentionPath(path))
+	if err == errors.ErrFileNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func (d *WORMDriver) Update(path string, data []byte, prepend bool) error {
+	return d.change(path, func() error {
+		return d.driver.Update(path, data, prepend)
+	})
+}
+
+func (d *WORMDriver) List(prefix string) ([]string, error) {
+	paths, err := listFiles(d.driver, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if !isRetentionPath(path) {
+			visible = append(visible, path)
+		}
+	}
+
+	return visible, nil
+}
+
+// RetainUntil returns when the lock on path ends. The zero time means it
+// never does.
+func (d *WORMDriver) RetainUntil(path string) (time.Time, error) {
+	record, err := d.retention(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return record.RetainUntil, nil
+}
+
+// ExtendRetention moves the end of the lock on path to until. Like Object
+// Lock, retention can only be extended, never shortened.
+func (d *WORMDriver) ExtendRetention(path string, until time.Time) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	record, err := d.retention(path)
+	if err != nil {
+		return err
+	}
+
+	if record.RetainUntil.IsZero() || !until.After(record.RetainUntil) {
+		return errors.ErrPermissionDenied
+	}
+
+	return d.putRetention(path, retentionRecord{RetainUntil: until})
+}
+
+// change applies a change to an unlocked path and starts a new retention
+// period for it.
+func (d *WORMDriver) change(path string, apply func() error) error {
+	if isRetentionPath(path) {
+		return errors.ErrPermissionDenied
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if err := d.checkUnlocked(path); err != nil {
+		return err
+	}
+
+	if err := apply(); err != nil {
+		return err
+	}
+
+	var record retentionRecord
+	if d.opts.Retention > 0 {
+		record.RetainUntil = d.now().Add(d.opts.Retention)
+	}
+
+	return d.putRetention(path, record)
+}
+
+func (d *WORMDriver) checkUnlocked(path string) error {
+	record, err := d.retention(path)
+	if err == errors.ErrFileNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if record.RetainUntil.IsZero() || d.now().Before(record.RetainUntil) {
+		return errors.ErrPermissionDenied
+	}
+
+	return nil
+}
+
+// retention returns the record for path, ErrFileNotFound when the file
+// does not exist, and a record without end for files that exist without
+// one.
+func (d *WORMDriver) retention(path string) (retentionRecord, error) {
+	var record retentionRecord
+
+	reader, err := d.driver.Read(retentionPath(path))
+	if err == errors.ErrFileNotFound {
+		reader, err = d.driver.Read(path)
+		if err != nil {
+			return record, err
+		}
+		reader.Close()
+
+		return record, nil
+	}
+
+	if err != nil {
+		return record, err
+	}
+	defer reader.Close()
+
+	if err := json.NewDecoder(reader).Decode(&record); err != nil {
+		return record, errors.ErrCorruptData
+	}
+
+	return record, nil
+}
+
+func (d *WORMDriver) putRetention(path string, record retentionRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return d.driver.Put(retentionPath(path), data)
+}
+
+func retentionPath(path string) string {
+	return retentionDir + "/" + strings.TrimPrefix(path, "/")
+}
+
+func isRetentionPath(path string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(path, "/"), retentionDir+"/")
+}
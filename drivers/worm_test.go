@@ -0,0 +1,69 @@
+package drivers
+
+import (
+	"github.com/vanvanni/lampofs/errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestWORMDriver(driver Driver, opts WORMOptions) (*WORMDriver, *time.Time) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	worm := NewWORMDriver(driver, opts)
+	worm.now = func() time.Time { return clock }
+
+	return worm, &clock
+}
+
+func TestWORMDriverWriteOnce(t *testing.T) {
+	worm, _ := newTestWORMDriver(NewMemoryDriver(), WORMOptions{})
+
+	assert.NoError(t, worm.Write("audit/1.log", []byte("entry")))
+	assert.Equal(t, "entry", readString(t, worm, "audit/1.log"))
+
+	assert.Equal(t, errors.ErrPermissionDenied, worm.Write("audit/1.log", []byte("again")))
+	assert.Equal(t, errors.ErrPermissionDenied, worm.Put("audit/1.log", []byte("changed")))
+	assert.Equal(t, errors.ErrPermissionDenied, worm.Update("audit/1.log", []byte("more"), false))
+	assert.Equal(t, errors.ErrPermissionDenied, worm.Delete("audit/1.log"))
+	assert.Equal(t, "entry", readString(t, worm, "audit/1.log"))
+
+	until, err := worm.RetainUntil("audit/1.log")
+	assert.NoError(t, err)
+	assert.True(t, until.IsZero())
+}
+
+func TestWORMDriverRetention(t *testing.T) {
+	worm, clock := newTestWORMDriver(NewMemoryDriver(), WORMOptions{Retention: 24 * time.Hour})
+
+	assert.NoError(t, worm.Write("a.txt", []byte("a")))
+	assert.Equal(t, errors.ErrPermissionDenied, worm.Delete("a.txt"))
+
+	// Retention can be extended but not shortened
+	assert.Equal(t, errors.ErrPermissionDenied, worm.ExtendRetention("a.txt", clock.Add(time.Hour)))
+	assert.NoError(t, worm.ExtendRetention("a.txt", clock.Add(48*time.Hour)))
+
+	*clock = clock.Add(25 * time.Hour)
+	assert.Equal(t, errors.ErrPermissionDenied, worm.Delete("a.txt"))
+
+	*clock = clock.Add(24 * time.Hour)
+	assert.NoError(t, worm.Delete("a.txt"))
+
+	paths, err := worm.List("")
+	assert.NoError(t, err)
+	assert.Empty(t, paths)
+}
+
+func TestWORMDriverExistingFiles(t *testing.T) {
+	memory := NewMemoryDriver()
+	memory.Write("old.txt", []byte("old"))
+
+	worm, _ := newTestWORMDriver(memory, WORMOptions{Retention: time.Hour})
+
+	assert.Equal(t, errors.ErrPermissionDenied, worm.Put("old.txt", []byte("new")))
+	assert.Equal(t, errors.ErrPermissionDenied, worm.Put(".retention/old.txt", []byte(`{}`)))
+
+	_, err := worm.RetainUntil("missing.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+}
@@ -1,9 +1,54 @@
 package errors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrFileNotFound     = errors.New("file not found")
 	ErrFileExists       = errors.New("file already exists")
 	ErrPermissionDenied = errors.New("permission denied")
+	ErrUnknownDriver    = errors.New("unknown driver")
+	ErrInvalidDSN       = errors.New("invalid driver dsn")
+	ErrDiskNotFound     = errors.New("disk not found")
+	ErrNotSupported     = errors.New("operation not supported")
+	ErrNotMounted       = errors.New("no driver mounted for path")
+	ErrCorruptData      = errors.New("corrupt data")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrCircuitOpen      = errors.New("circuit open")
+	ErrUnexpectedCall   = errors.New("unexpected call")
+	ErrAuditTampered    = errors.New("audit log tampered")
 )
+
+// QuotaError reports which limit an operation would have exceeded. It
+// matches ErrQuotaExceeded with errors.Is.
+type QuotaError struct {
+	Prefix    string
+	Limit     string // bytes, files or file_size
+	Max       int64
+	Requested int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded for %q: %s %d > %d", e.Prefix, e.Limit, e.Requested, e.Max)
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// AuditError reports where an audit log stops verifying. It matches
+// ErrAuditTampered with errors.Is.
+type AuditError struct {
+	Line   int
+	Reason string
+}
+
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("audit log tampered at line %d: %s", e.Line, e.Reason)
+}
+
+func (e *AuditError) Is(target error) bool {
+	return target == ErrAuditTampered
+}
@@ -1,12 +1,16 @@
 package lampofs
 
 import (
+	"github.com/vanvanni/lampofs/drivers"
 	"io"
+	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 type LampEvent struct {
-	Type      string // READ, WRITE, PUT, DELETE, UPDATE
+	Type      string // READ, WRITE, PUT, DELETE, APPEND, PREPEND, TRASH, RESTORE, PURGE
 	Path      string
 	Timestamp int64
 	Data      interface{}
@@ -20,9 +24,20 @@ type Driver interface {
 	Update(path string, data []byte, prepend bool) error
 }
 
+type Lister interface {
+	List(prefix string) ([]string, error)
+}
+
 type Lampo struct {
-	driver Driver
-	events []func(event LampEvent)
+	driver         Driver
+	events         []func(event LampEvent)
+	trashDir       string
+	trashRetention time.Duration
+	purgeErr       error
+	tracer         trace.Tracer
+	logging        *drivers.LoggingOptions
+	now            func() time.Time
+	mutex          sync.Mutex
 }
 
 type LampoOption func(*Lampo)
@@ -31,6 +46,7 @@ func NewLampo(driver Driver, opts ...LampoOption) *Lampo {
 	lampo := &Lampo{
 		driver: driver,
 		events: make([]func(LampEvent), 0),
+		now:    time.Now,
 	}
 
 	for _, opt := range opts {
@@ -45,7 +61,9 @@ func (l *Lampo) On(handler func(event LampEvent)) {
 }
 
 func (l *Lampo) Read(path string) (io.ReadCloser, error) {
+	end := l.begin("Read", "READ", path, -1)
 	reader, err := l.driver.Read(path)
+	end(err)
 	if err != nil {
 		return nil, err
 	}
@@ -60,7 +78,9 @@ func (l *Lampo) Read(path string) (io.ReadCloser, error) {
 }
 
 func (l *Lampo) Write(path string, data []byte) error {
+	end := l.begin("Write", "WRITE", path, len(data))
 	err := l.driver.Write(path, data)
+	end(err)
 	if err != nil {
 		return err
 	}
@@ -76,7 +96,9 @@ func (l *Lampo) Write(path string, data []byte) error {
 }
 
 func (l *Lampo) Put(path string, data []byte) error {
+	end := l.begin("Put", "PUT", path, len(data))
 	err := l.driver.Put(path, data)
+	end(err)
 	if err != nil {
 		return err
 	}
@@ -92,7 +114,16 @@ func (l *Lampo) Put(path string, data []byte) error {
 }
 
 func (l *Lampo) Delete(path string) error {
+	end := l.begin("Delete", "DELETE", path, -1)
+
+	if l.trashDir != "" {
+		err := l.trash(path)
+		end(err)
+		return err
+	}
+
 	err := l.driver.Delete(path)
+	end(err)
 	if err != nil {
 		return err
 	}
@@ -107,16 +138,18 @@ func (l *Lampo) Delete(path string) error {
 }
 
 func (l *Lampo) Update(path string, data []byte, prepend bool) error {
-	err := l.driver.Update(path, data, prepend)
-	if err != nil {
-		return err
-	}
-
 	action := "APPEND"
 	if prepend {
 		action = "PREPEND"
 	}
 
+	end := l.begin("Update", action, path, len(data))
+	err := l.driver.Update(path, data, prepend)
+	end(err)
+	if err != nil {
+		return err
+	}
+
 	l.fireEvent(LampEvent{
 		Type:      action,
 		Path:      path,
@@ -127,6 +160,21 @@ func (l *Lampo) Update(path string, data []byte, prepend bool) error {
 	return nil
 }
 
+// begin starts tracing operation and logging it as action, the event type,
+// and returns the function that finishes both. A negative size is left out.
+func (l *Lampo) begin(operation, action, path string, size int) func(err error) {
+	start := time.Now()
+	endSpan := l.startSpan(operation, path, size)
+
+	return func(err error) {
+		endSpan(err)
+
+		if l.logging != nil {
+			l.logging.LogOperation(action, path, size, time.Since(start), err)
+		}
+	}
+}
+
 func (l *Lampo) fireEvent(event LampEvent) {
 	for _, handler := range l.events {
 		handler(event)
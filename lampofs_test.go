@@ -2,6 +2,7 @@ package lampofs
 
 import (
 	"bytes"
+	"github.com/vanvanni/lampofs/drivers"
 	"io"
 	"testing"
 	"time"
@@ -156,3 +157,19 @@ func TestLampoOn(t *testing.T) {
 
 	assert.True(t, eventReceived)
 }
+
+func TestLampoPrefixEventPaths(t *testing.T) {
+	memory := drivers.NewMemoryDriver()
+	lampo := NewLampo(drivers.NewPrefixDriver(memory, "services/billing"))
+
+	paths := make([]string, 0)
+	lampo.On(func(event LampEvent) {
+		paths = append(paths, event.Path)
+	})
+
+	assert.NoError(t, lampo.Write("invoices/1.pdf", []byte("pdf")))
+	assert.NoError(t, lampo.Delete("invoices/1.pdf"))
+
+	// Events carry the path as the service sees it
+	assert.Equal(t, []string{"invoices/1.pdf", "invoices/1.pdf"}, paths)
+}
@@ -0,0 +1,13 @@
+package lampofs
+
+import (
+	"github.com/vanvanni/lampofs/drivers"
+)
+
+// WithLogging logs every Lampo operation with its path, size, duration and
+// error, in the same format as drivers.NewLoggingDriver.
+func WithLogging(opts drivers.LoggingOptions) LampoOption {
+	return func(l *Lampo) {
+		l.logging = &opts
+	}
+}
@@ -0,0 +1,31 @@
+package lampofs
+
+import (
+	"bytes"
+	"github.com/vanvanni/lampofs/drivers"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLampoLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	lampo := NewLampo(drivers.NewMemoryDriver(), WithLogging(drivers.LoggingOptions{
+		Logger: logger,
+		Level:  slog.LevelInfo,
+		Redact: drivers.RedactMatching("*.env"),
+	}))
+
+	lampo.Write("app/.env", []byte("SECRET=1"))
+	lampo.Update("app/log.txt", []byte("line"), false)
+	lampo.Delete("app/missing.txt")
+
+	assert.Contains(t, buf.String(), `level=INFO msg="lampofs WRITE" operation=WRITE path=[redacted]`)
+	assert.NotContains(t, buf.String(), ".env")
+	assert.Contains(t, buf.String(), `operation=APPEND path=app/log.txt`)
+	assert.Contains(t, buf.String(), `size=4`)
+	assert.Contains(t, buf.String(), `operation=DELETE path=app/missing.txt`)
+}
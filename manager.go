@@ -0,0 +1,165 @@
+package lampofs
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/vanvanni/lampofs/drivers"
+	"github.com/vanvanni/lampofs/errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Default string                `json:"default" yaml:"default"`
+	Disks   map[string]DiskConfig `json:"disks" yaml:"disks"`
+}
+
+type DiskConfig struct {
+	Driver string       `json:"driver" yaml:"driver"` // local, memory, s3
+	URL    string       `json:"url" yaml:"url"`       // DSN passed to OpenDriver instead of Driver
+	Root   string       `json:"root" yaml:"root"`
+	S3     S3DiskConfig `json:"s3" yaml:"s3"`
+
+	ReadOnly bool   `json:"read_only" yaml:"read_only"`
+	Prefix   string `json:"prefix" yaml:"prefix"`
+}
+
+type S3DiskConfig struct {
+	Region   string `json:"region" yaml:"region"`
+	Bucket   string `json:"bucket" yaml:"bucket"`
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	Prefix   string `json:"prefix" yaml:"prefix"`
+}
+
+type Manager struct {
+	disks       map[string]*Lampo
+	defaultDisk string
+}
+
+// LoadConfig reads a JSON or YAML config file, picking the format from the
+// file extension.
+func LoadConfig(path string) (Config, error) {
+	var cfg Config
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &cfg)
+	default:
+		err = fmt.Errorf("unsupported config format %q", filepath.Ext(path))
+	}
+
+	return cfg, err
+}
+
+func LoadManager(path string, opts ...LampoOption) (*Manager, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewManager(cfg, opts...)
+}
+
+// NewManager builds every disk in the config. The options are applied to
+// each Lampo instance.
+func NewManager(cfg Config, opts ...LampoOption) (*Manager, error) {
+	manager := &Manager{
+		disks:       make(map[string]*Lampo, len(cfg.Disks)),
+		defaultDisk: cfg.Default,
+	}
+
+	for name, disk := range cfg.Disks {
+		driver, err := newDiskDriver(disk)
+		if err != nil {
+			return nil, fmt.Errorf("disk %q: %w", name, err)
+		}
+
+		manager.disks[name] = NewLampo(driver, opts...)
+	}
+
+	if manager.defaultDisk == "" && len(cfg.Disks) == 1 {
+		for name := range cfg.Disks {
+			manager.defaultDisk = name
+		}
+	}
+
+	if _, exists := manager.disks[manager.defaultDisk]; manager.defaultDisk != "" && !exists {
+		return nil, fmt.Errorf("%w: default %q", errors.ErrDiskNotFound, manager.defaultDisk)
+	}
+
+	return manager, nil
+}
+
+func (m *Manager) Disk(name string) (*Lampo, error) {
+	lampo, exists := m.disks[name]
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", errors.ErrDiskNotFound, name)
+	}
+
+	return lampo, nil
+}
+
+// Default returns the default disk, or nil when none is configured.
+func (m *Manager) Default() *Lampo {
+	return m.disks[m.defaultDisk]
+}
+
+func (m *Manager) Names() []string {
+	names := make([]string, 0, len(m.disks))
+	for name := range m.disks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func newDiskDriver(disk DiskConfig) (Driver, error) {
+	var (
+		driver Driver
+		err    error
+	)
+
+	switch {
+	case disk.URL != "":
+		driver, err = OpenDriver(disk.URL)
+	case disk.Driver == "local":
+		driver, err = drivers.NewLocalDriver(disk.Root)
+	case disk.Driver == "memory":
+		driver = drivers.NewMemoryDriver()
+	case disk.Driver == "s3":
+		driver, err = drivers.NewS3Driver(drivers.S3Options{
+			Region:     disk.S3.Region,
+			BucketName: disk.S3.Bucket,
+			Endpoint:   disk.S3.Endpoint,
+			Prefix:     disk.S3.Prefix,
+		})
+	default:
+		err = fmt.Errorf("%w: %q", errors.ErrUnknownDriver, disk.Driver)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if disk.Prefix != "" {
+		driver = drivers.NewPrefixDriver(driver, disk.Prefix)
+	}
+
+	if disk.ReadOnly {
+		driver = drivers.NewReadOnlyDriver(driver)
+	}
+
+	return driver, nil
+}
@@ -0,0 +1,112 @@
+package lampofs
+
+import (
+	"github.com/vanvanni/lampofs/drivers"
+	"github.com/vanvanni/lampofs/errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlPath := filepath.Join(dir, "disks.yaml")
+	err := os.WriteFile(yamlPath, []byte(`
+default: uploads
+disks:
+  uploads:
+    driver: local
+    root: /var/data/uploads
+    prefix: tenants
+  media:
+    driver: s3
+    read_only: true
+    s3:
+      region: eu-west-1
+      bucket: media
+`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err := LoadConfig(yamlPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "uploads", cfg.Default)
+	assert.Equal(t, "/var/data/uploads", cfg.Disks["uploads"].Root)
+	assert.Equal(t, "tenants", cfg.Disks["uploads"].Prefix)
+	assert.Equal(t, "media", cfg.Disks["media"].S3.Bucket)
+	assert.True(t, cfg.Disks["media"].ReadOnly)
+
+	jsonPath := filepath.Join(dir, "disks.json")
+	err = os.WriteFile(jsonPath, []byte(`{"default": "cache", "disks": {"cache": {"driver": "memory"}}}`), 0644)
+	assert.NoError(t, err)
+
+	cfg, err = LoadConfig(jsonPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "cache", cfg.Default)
+	assert.Equal(t, "memory", cfg.Disks["cache"].Driver)
+
+	_, err = LoadConfig(filepath.Join(dir, "disks.toml"))
+	assert.Error(t, err)
+}
+
+func TestManager(t *testing.T) {
+	root := t.TempDir()
+
+	manager, err := NewManager(Config{
+		Default: "uploads",
+		Disks: map[string]DiskConfig{
+			"uploads": {Driver: "local", Root: root, Prefix: "tenants"},
+			"cache":   {URL: "mem://"},
+			"backups": {Driver: "memory", ReadOnly: true},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"backups", "cache", "uploads"}, manager.Names())
+
+	uploads, err := manager.Disk("uploads")
+	assert.NoError(t, err)
+	assert.Equal(t, uploads, manager.Default())
+
+	err = uploads.Put("test.txt", []byte("test data"))
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(root, "tenants", "test.txt"))
+
+	cache, err := manager.Disk("cache")
+	assert.NoError(t, err)
+	assert.IsType(t, &drivers.MemoryDriver{}, cache.driver)
+
+	backups, err := manager.Disk("backups")
+	assert.NoError(t, err)
+	assert.Equal(t, errors.ErrPermissionDenied, backups.Put("test.txt", []byte("test data")))
+
+	_, err = manager.Disk("missing")
+	assert.ErrorIs(t, err, errors.ErrDiskNotFound)
+}
+
+func TestManagerErrors(t *testing.T) {
+	_, err := NewManager(Config{
+		Disks: map[string]DiskConfig{
+			"uploads": {Driver: "ftp"},
+		},
+	})
+	assert.ErrorIs(t, err, errors.ErrUnknownDriver)
+
+	_, err = NewManager(Config{
+		Default: "missing",
+		Disks: map[string]DiskConfig{
+			"cache": {Driver: "memory"},
+		},
+	})
+	assert.ErrorIs(t, err, errors.ErrDiskNotFound)
+
+	// A single disk becomes the default
+	manager, err := NewManager(Config{
+		Disks: map[string]DiskConfig{
+			"cache": {Driver: "memory"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, manager.Default())
+}
@@ -0,0 +1,92 @@
+package lampofs
+
+import (
+	"fmt"
+	"github.com/vanvanni/lampofs/drivers"
+	"github.com/vanvanni/lampofs/errors"
+	"net/url"
+	"path/filepath"
+	"sync"
+)
+
+// DriverFactory builds a Driver from a parsed DSN such as
+// "s3://bucket/prefix?region=eu-west-1" or "file:///var/data".
+type DriverFactory func(u *url.URL) (Driver, error)
+
+var (
+	registry      = make(map[string]DriverFactory)
+	registryMutex sync.RWMutex
+)
+
+func init() {
+	Register("file", openLocal)
+	Register("mem", openMemory)
+	Register("memory", openMemory)
+	Register("s3", openS3)
+}
+
+// Register makes a driver available to Open under the given URL scheme.
+// Registering a scheme twice replaces the previous factory.
+func Register(scheme string, factory DriverFactory) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	registry[scheme] = factory
+}
+
+// OpenDriver parses the DSN and returns the Driver registered for its scheme.
+func OpenDriver(dsn string) (Driver, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	registryMutex.RLock()
+	factory, exists := registry[u.Scheme]
+	registryMutex.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("%w: %q", errors.ErrUnknownDriver, u.Scheme)
+	}
+
+	return factory(u)
+}
+
+// Open returns a Lampo backed by the driver described by the DSN.
+func Open(dsn string, opts ...LampoOption) (*Lampo, error) {
+	driver, err := OpenDriver(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLampo(driver, opts...), nil
+}
+
+func openLocal(u *url.URL) (Driver, error) {
+	// file://./data puts the relative root in the host part
+	root := filepath.FromSlash(u.Host + u.Path)
+	if root == "" {
+		return nil, fmt.Errorf("%w: file driver requires a root path", errors.ErrInvalidDSN)
+	}
+
+	return drivers.NewLocalDriver(root)
+}
+
+func openMemory(u *url.URL) (Driver, error) {
+	return drivers.NewMemoryDriver(), nil
+}
+
+func openS3(u *url.URL) (Driver, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("%w: s3 driver requires a bucket", errors.ErrInvalidDSN)
+	}
+
+	query := u.Query()
+
+	return drivers.NewS3Driver(drivers.S3Options{
+		Region:     query.Get("region"),
+		BucketName: u.Host,
+		Endpoint:   query.Get("endpoint"),
+		Prefix:     u.Path,
+	})
+}
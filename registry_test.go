@@ -0,0 +1,68 @@
+package lampofs
+
+import (
+	"github.com/vanvanni/lampofs/drivers"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenMemory(t *testing.T) {
+	lampo, err := Open("mem://")
+	assert.NoError(t, err)
+	assert.IsType(t, &drivers.MemoryDriver{}, lampo.driver)
+
+	err = lampo.Write("test.txt", []byte("test data"))
+	assert.NoError(t, err)
+
+	reader, err := lampo.Read("test.txt")
+	assert.NoError(t, err)
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "test data", string(data))
+}
+
+func TestOpenFile(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "data")
+
+	lampo, err := Open("file://" + filepath.ToSlash(root))
+	assert.NoError(t, err)
+	assert.IsType(t, &drivers.LocalDriver{}, lampo.driver)
+
+	err = lampo.Put("test.txt", []byte("test data"))
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(root, "test.txt"))
+}
+
+func TestOpenErrors(t *testing.T) {
+	_, err := Open("ftp://example.com/files")
+	assert.ErrorIs(t, err, errors.ErrUnknownDriver)
+
+	_, err = Open("file://")
+	assert.ErrorIs(t, err, errors.ErrInvalidDSN)
+
+	_, err = Open("s3:///prefix")
+	assert.ErrorIs(t, err, errors.ErrInvalidDSN)
+}
+
+func TestRegister(t *testing.T) {
+	driver := &mockDriver{}
+
+	var received *url.URL
+	Register("mock", func(u *url.URL) (Driver, error) {
+		received = u
+		return driver, nil
+	})
+
+	lampo, err := Open("mock://host/path?option=value")
+	assert.NoError(t, err)
+	assert.Equal(t, driver, lampo.driver)
+	assert.Equal(t, "host", received.Host)
+	assert.Equal(t, "value", received.Query().Get("option"))
+}
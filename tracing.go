@@ -0,0 +1,48 @@
+package lampofs
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTracing records an OpenTelemetry span for every Lampo operation. A
+// nil provider uses the global one. Operations do not take a context yet,
+// so each span starts a new trace.
+func WithTracing(provider trace.TracerProvider) LampoOption {
+	return func(l *Lampo) {
+		if provider == nil {
+			provider = otel.GetTracerProvider()
+		}
+
+		l.tracer = provider.Tracer("github.com/vanvanni/lampofs")
+	}
+}
+
+// startSpan returns the function that ends the span with the result of
+// the operation. Without tracing it does nothing. A negative size is left
+// out of the attributes.
+func (l *Lampo) startSpan(operation, path string, size int) func(err error) {
+	if l.tracer == nil {
+		return func(error) {}
+	}
+
+	attributes := []attribute.KeyValue{attribute.String("lampofs.path", path)}
+	if size >= 0 {
+		attributes = append(attributes, attribute.Int("lampofs.bytes", size))
+	}
+
+	_, span := l.tracer.Start(context.Background(), "Lampo."+operation, trace.WithAttributes(attributes...))
+
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+
+		span.End()
+	}
+}
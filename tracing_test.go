@@ -0,0 +1,44 @@
+package lampofs
+
+import (
+	"github.com/vanvanni/lampofs/drivers"
+	"github.com/vanvanni/lampofs/errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestLampoTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	lampo := NewLampo(drivers.NewMemoryDriver(), WithTracing(provider))
+
+	assert.NoError(t, lampo.Write("a.txt", []byte("hello")))
+	_, err := lampo.Read("missing.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+
+	assert.Equal(t, "Lampo.Write", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), attribute.String("lampofs.path", "a.txt"))
+	assert.Contains(t, spans[0].Attributes(), attribute.Int("lampofs.bytes", 5))
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	assert.Equal(t, "Lampo.Read", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
+func TestLampoWithoutTracing(t *testing.T) {
+	lampo := NewLampo(drivers.NewMemoryDriver())
+
+	assert.NoError(t, lampo.Put("a.txt", []byte("a")))
+	assert.NoError(t, lampo.Delete("a.txt"))
+}
@@ -0,0 +1,263 @@
+package lampofs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	pathpkg "path"
+	"sort"
+	"strings"
+	"time"
+)
+
+type TrashItem struct {
+	ID           string `json:"id"`
+	OriginalPath string `json:"original_path"`
+	DeletedAt    int64  `json:"deleted_at"`
+	Size         int    `json:"size"`
+}
+
+// WithTrash makes Delete move files into dir instead of removing them.
+// Each trashed file is stored as dir/<id> next to its dir/<id>.json
+// metadata.
+func WithTrash(dir string) LampoOption {
+	return func(l *Lampo) {
+		l.trashDir = strings.Trim(dir, "/")
+	}
+}
+
+// WithTrashRetention purges trashed files once they have been in the trash
+// for longer than retention. The purge runs on every Delete and needs a
+// driver that implements Lister. It does not fail the Delete, see PurgeErr.
+func WithTrashRetention(retention time.Duration) LampoOption {
+	return func(l *Lampo) {
+		l.trashRetention = retention
+	}
+}
+
+// ListTrash returns the trashed files, most recently deleted first. The
+// driver must implement Lister.
+func (l *Lampo) ListTrash() ([]TrashItem, error) {
+	lister, ok := l.driver.(Lister)
+	if !ok || l.trashDir == "" {
+		return nil, errors.ErrNotSupported
+	}
+
+	paths, err := lister.List(l.trashDir + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]TrashItem, 0)
+	for _, path := range paths {
+		if !strings.HasSuffix(path, ".json") {
+			continue
+		}
+
+		item, err := l.trashItem(strings.TrimSuffix(path[len(l.trashDir)+1:], ".json"))
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].ID > items[j].ID
+	})
+
+	return items, nil
+}
+
+// Restore moves a trashed file back to its original path. It fails with
+// ErrFileExists when a new file has taken that path in the meantime.
+func (l *Lampo) Restore(id string) error {
+	item, err := l.trashItem(id)
+	if err != nil {
+		return err
+	}
+
+	reader, err := l.driver.Read(l.trashPath(id))
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := l.driver.Write(item.OriginalPath, data); err != nil {
+		return err
+	}
+
+	if err := l.removeTrashed(id); err != nil {
+		return err
+	}
+
+	l.fireEvent(LampEvent{
+		Type:      "RESTORE",
+		Path:      item.OriginalPath,
+		Timestamp: time.Now().Unix(),
+		Data:      item,
+	})
+
+	return nil
+}
+
+// Purge permanently deletes trashed files deleted longer than olderThan
+// ago, or all of them when olderThan is 0. It returns how many were purged.
+func (l *Lampo) Purge(olderThan time.Duration) (int, error) {
+	items, err := l.ListTrash()
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := l.now().Add(-olderThan).Unix()
+	purged := 0
+
+	for _, item := range items {
+		if olderThan > 0 && item.DeletedAt > cutoff {
+			continue
+		}
+
+		if err := l.removeTrashed(item.ID); err != nil {
+			return purged, err
+		}
+		purged++
+
+		l.fireEvent(LampEvent{
+			Type:      "PURGE",
+			Path:      item.OriginalPath,
+			Timestamp: l.now().Unix(),
+			Data:      item,
+		})
+	}
+
+	return purged, nil
+}
+
+func (l *Lampo) trash(path string) error {
+	// Trashed files leave the trash through Purge only
+	if l.inTrash(path) {
+		return errors.ErrPermissionDenied
+	}
+
+	reader, err := l.driver.Read(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	deletedAt := l.now()
+	item := TrashItem{
+		ID:           newTrashID(deletedAt),
+		OriginalPath: path,
+		DeletedAt:    deletedAt.Unix(),
+		Size:         len(data),
+	}
+
+	meta, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+
+	if err := l.driver.Write(l.trashPath(item.ID), data); err != nil {
+		return err
+	}
+
+	if err := l.driver.Write(l.trashPath(item.ID)+".json", meta); err != nil {
+		return err
+	}
+
+	if err := l.driver.Delete(path); err != nil {
+		return err
+	}
+
+	l.fireEvent(LampEvent{
+		Type:      "TRASH",
+		Path:      path,
+		Timestamp: item.DeletedAt,
+		Data:      item,
+	})
+
+	if _, ok := l.driver.(Lister); ok && l.trashRetention > 0 {
+		l.purgeExpired()
+	}
+
+	return nil
+}
+
+// PurgeErr returns the error of the last automatic purge, nil when it
+// succeeded. The file was already in the trash by then, so the Delete that
+// ran the purge still succeeded.
+func (l *Lampo) PurgeErr() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.purgeErr
+}
+
+func (l *Lampo) purgeExpired() {
+	start := l.now()
+	_, err := l.Purge(l.trashRetention)
+
+	l.mutex.Lock()
+	l.purgeErr = err
+	l.mutex.Unlock()
+
+	if err != nil && l.logging != nil {
+		l.logging.LogOperation("PURGE", l.trashDir, -1, l.now().Sub(start), err)
+	}
+}
+
+func (l *Lampo) trashItem(id string) (TrashItem, error) {
+	var item TrashItem
+
+	if l.trashDir == "" {
+		return item, errors.ErrNotSupported
+	}
+
+	reader, err := l.driver.Read(l.trashPath(id) + ".json")
+	if err != nil {
+		return item, err
+	}
+	defer reader.Close()
+
+	err = json.NewDecoder(reader).Decode(&item)
+	return item, err
+}
+
+func (l *Lampo) removeTrashed(id string) error {
+	if err := l.driver.Delete(l.trashPath(id)); err != nil {
+		return err
+	}
+
+	return l.driver.Delete(l.trashPath(id) + ".json")
+}
+
+func (l *Lampo) inTrash(path string) bool {
+	path = strings.TrimPrefix(pathpkg.Clean("/"+path), "/")
+	return path == l.trashDir || strings.HasPrefix(path, l.trashDir+"/")
+}
+
+func (l *Lampo) trashPath(id string) string {
+	return l.trashDir + "/" + id
+}
+
+// newTrashID is sortable by deletion time and unique across processes.
+func newTrashID(deletedAt time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	return fmt.Sprintf("%019d-%s", deletedAt.UnixNano(), hex.EncodeToString(suffix))
+}
@@ -0,0 +1,197 @@
+package lampofs
+
+import (
+	"fmt"
+	"github.com/vanvanni/lampofs/drivers"
+	"github.com/vanvanni/lampofs/errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLampoTrash(t *testing.T) {
+	driver := drivers.NewMemoryDriver()
+	lampo := NewLampo(driver, WithTrash(".trash"))
+
+	events := make([]LampEvent, 0)
+	lampo.On(func(event LampEvent) {
+		events = append(events, event)
+	})
+
+	assert.NoError(t, lampo.Write("docs/report.txt", []byte("report")))
+
+	// Test Delete moves the file into the trash
+	err := lampo.Delete("docs/report.txt")
+	assert.NoError(t, err)
+
+	_, err = lampo.Read("docs/report.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+
+	items, err := lampo.ListTrash()
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "docs/report.txt", items[0].OriginalPath)
+	assert.Equal(t, 6, items[0].Size)
+
+	assert.Equal(t, "TRASH", events[len(events)-1].Type)
+	assert.Equal(t, "docs/report.txt", events[len(events)-1].Path)
+
+	// Test Restore puts the file back
+	err = lampo.Restore(items[0].ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "RESTORE", events[len(events)-1].Type)
+
+	reader, err := lampo.Read("docs/report.txt")
+	assert.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "report", string(data))
+
+	items, err = lampo.ListTrash()
+	assert.NoError(t, err)
+	assert.Empty(t, items)
+
+	// Test Restore refuses to overwrite a newer file
+	assert.NoError(t, lampo.Delete("docs/report.txt"))
+	assert.NoError(t, lampo.Write("docs/report.txt", []byte("newer")))
+
+	items, err = lampo.ListTrash()
+	assert.NoError(t, err)
+	assert.Equal(t, errors.ErrFileExists, lampo.Restore(items[0].ID))
+
+	// Test deleting a missing file
+	assert.Equal(t, errors.ErrFileNotFound, lampo.Delete("missing.txt"))
+}
+
+func TestLampoPurge(t *testing.T) {
+	driver := drivers.NewMemoryDriver()
+	lampo := NewLampo(driver, WithTrash(".trash"))
+
+	purged := make([]string, 0)
+	lampo.On(func(event LampEvent) {
+		if event.Type == "PURGE" {
+			purged = append(purged, event.Path)
+		}
+	})
+
+	assert.NoError(t, lampo.Write("a.txt", []byte("a")))
+	assert.NoError(t, lampo.Write("b.txt", []byte("b")))
+	assert.NoError(t, lampo.Delete("a.txt"))
+	assert.NoError(t, lampo.Delete("b.txt"))
+
+	// Test Purge by age keeps recent deletions
+	count, err := lampo.Purge(time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// Test Purge without an age empties the trash
+	count, err = lampo.Purge(0)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.ElementsMatch(t, []string{"a.txt", "b.txt"}, purged)
+
+	paths, err := driver.List("")
+	assert.NoError(t, err)
+	assert.Empty(t, paths)
+}
+
+func TestLampoTrashDisabled(t *testing.T) {
+	lampo := NewLampo(drivers.NewMemoryDriver())
+
+	_, err := lampo.ListTrash()
+	assert.Equal(t, errors.ErrNotSupported, err)
+
+	// Test drivers that cannot list
+	lampo = NewLampo(&mockDriver{}, WithTrash(".trash"))
+
+	_, err = lampo.ListTrash()
+	assert.Equal(t, errors.ErrNotSupported, err)
+}
+
+func TestLampoTrashRetention(t *testing.T) {
+	driver := drivers.NewMemoryDriver()
+	lampo := NewLampo(driver, WithTrash(".trash"), WithTrashRetention(24*time.Hour))
+
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	lampo.now = func() time.Time { return clock }
+
+	assert.NoError(t, lampo.Write("a.txt", []byte("a")))
+	assert.NoError(t, lampo.Write("b.txt", []byte("b")))
+	assert.NoError(t, lampo.Delete("a.txt"))
+
+	// Test the next Delete purges what outlived the retention
+	clock = clock.Add(25 * time.Hour)
+	assert.NoError(t, lampo.Delete("b.txt"))
+
+	items, err := lampo.ListTrash()
+	assert.NoError(t, err)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, "b.txt", items[0].OriginalPath)
+	}
+}
+
+func TestLampoTrashDeleteInTrash(t *testing.T) {
+	driver := drivers.NewMemoryDriver()
+	lampo := NewLampo(driver, WithTrash(".trash"))
+
+	assert.NoError(t, lampo.Write("a.txt", []byte("a")))
+	assert.NoError(t, lampo.Delete("a.txt"))
+
+	items, err := lampo.ListTrash()
+	assert.NoError(t, err)
+	if !assert.Len(t, items, 1) {
+		return
+	}
+
+	// Test trashed files cannot be trashed again
+	assert.Equal(t, errors.ErrPermissionDenied, lampo.Delete(".trash/"+items[0].ID))
+	assert.Equal(t, errors.ErrPermissionDenied, lampo.Delete("/.trash/"+items[0].ID+".json"))
+	assert.Equal(t, errors.ErrPermissionDenied, lampo.Delete("docs/../.trash/"+items[0].ID))
+
+	items, err = lampo.ListTrash()
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+}
+
+// stuckTrashDriver cannot delete anything inside the trash.
+type stuckTrashDriver struct {
+	*drivers.MemoryDriver
+}
+
+func (d stuckTrashDriver) Delete(path string) error {
+	if strings.HasPrefix(path, ".trash/") {
+		return errors.ErrPermissionDenied
+	}
+	return d.MemoryDriver.Delete(path)
+}
+
+func TestLampoTrashRetentionFailure(t *testing.T) {
+	lampo := NewLampo(stuckTrashDriver{drivers.NewMemoryDriver()}, WithTrash(".trash"), WithTrashRetention(time.Hour))
+
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	lampo.now = func() time.Time { return clock }
+
+	assert.NoError(t, lampo.Write("a.txt", []byte("a")))
+	assert.NoError(t, lampo.Write("b.txt", []byte("b")))
+	assert.NoError(t, lampo.Delete("a.txt"))
+	assert.NoError(t, lampo.PurgeErr())
+
+	// Test a failed purge does not fail the Delete that ran it
+	clock = clock.Add(2 * time.Hour)
+	assert.NoError(t, lampo.Delete("b.txt"))
+	assert.Equal(t, errors.ErrPermissionDenied, lampo.PurgeErr())
+
+	_, err := lampo.Read("b.txt")
+	assert.Equal(t, errors.ErrFileNotFound, err)
+
+	// Test IDs follow the same clock as DeletedAt
+	items, err := lampo.ListTrash()
+	assert.NoError(t, err)
+	if assert.Len(t, items, 2) {
+		assert.True(t, strings.HasPrefix(items[0].ID, fmt.Sprintf("%019d-", clock.UnixNano())))
+	}
+}